@@ -0,0 +1,61 @@
+// Command bootstrap-admin creates the first admin account. It reads the same
+// configuration as gophermart, the password is taken from ADMIN_PASSWORD so
+// that it doesn't end up in the shell history:
+//
+//	ADMIN_PASSWORD=... bootstrap-admin -d postgres://... -login admin
+package main
+
+import (
+	"flag"
+	"github.com/koyif/gophermart/internal/app"
+	"github.com/koyif/gophermart/internal/config"
+	"github.com/koyif/gophermart/internal/password"
+	"github.com/koyif/gophermart/internal/postgres"
+	"github.com/koyif/gophermart/internal/service"
+	"github.com/koyif/gophermart/pkg/dto"
+	"github.com/koyif/gophermart/pkg/logger"
+	"log"
+	"os"
+)
+
+func main() {
+	var login string
+	flag.StringVar(&login, "login", "", "логин администратора")
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("error loading config: %v", err)
+	}
+
+	if err = logger.Initialize(); err != nil {
+		log.Fatalf("error starting logger: %v", err)
+	}
+
+	pass := os.Getenv("ADMIN_PASSWORD")
+	if err = (dto.Auth{Login: login, Password: pass}).IsValidRegistration(); err != nil {
+		log.Fatalf("invalid admin credentials: %v", err)
+	}
+
+	hasher, err := password.New(cfg)
+	if err != nil {
+		log.Fatalf("error creating password hasher: %v", err)
+	}
+	policy, err := password.NewPolicy(cfg)
+	if err != nil {
+		log.Fatalf("error creating password policy: %v", err)
+	}
+
+	a, err := app.New(cfg)
+	if err != nil {
+		log.Fatalf("error creating app: %v", err)
+	}
+	userID, err := service.BootstrapAdmin(postgres.New(a.DB), hasher, policy, login, pass)
+	if closeErr := a.DB.Close(); closeErr != nil {
+		logger.Log.Error("error closing database connection", logger.Error(closeErr))
+	}
+	if err != nil {
+		log.Fatalf("admin not created: %v", err)
+	}
+
+	log.Printf("admin %q created with id %d", login, userID)
+}
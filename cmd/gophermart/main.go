@@ -34,7 +34,14 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
 
-	a.Run(ctx)
+	router, err := a.Router()
+	if err != nil {
+		logger.Log.Fatal("error creating router", logger.Error(err))
+	}
+
+	if err = a.Run(ctx); err != nil {
+		logger.Log.Fatal("error starting order processing", logger.Error(err))
+	}
 	ongoingCtx, cancelOngoingRequests := context.WithCancel(context.Background())
 	server := &http.Server{
 		Addr: ":8080",
@@ -43,7 +50,7 @@ func main() {
 		},
 	}
 
-	go startServer(a)
+	go startServer(a, router)
 
 	<-ctx.Done()
 	logger.Log.Info("shutting down")
@@ -72,9 +79,9 @@ func main() {
 	logger.Log.Info("shutdown complete")
 }
 
-func startServer(a *app.App) {
+func startServer(a *app.App, router http.Handler) {
 	logger.Log.Info("starting server", logger.String("address", a.Config.Addr))
-	if err := http.ListenAndServe(a.Config.Addr, a.Router()); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if err := http.ListenAndServe(a.Config.Addr, router); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Log.Error("server error", logger.Error(err))
 	}
 }
@@ -5,15 +5,20 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/koyif/gophermart/internal/postgres"
+	"github.com/koyif/gophermart/internal/rewards"
 	"github.com/koyif/gophermart/internal/service"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/koyif/gophermart/internal/config"
 )
 
+// App holds what the workers and the handlers share. Accrual routes the
+// orders between the accrual providers and the built-in rewards engine, it is
+// shared so that the dashboard sees the counters of the workers.
 type App struct {
-	Config *config.Config
-	DB     *sql.DB
+	Config  *config.Config
+	DB      *sql.DB
+	Accrual *service.AccrualSources
 }
 
 func New(cfg *config.Config) (*App, error) {
@@ -22,19 +27,33 @@ func New(cfg *config.Config) (*App, error) {
 		return nil, err
 	}
 
+	repository := postgres.New(dbPool)
+	accrual, err := service.NewAccrualSources(cfg, repository, map[string]service.AccrualSource{
+		service.AccrualSourceRewards: rewards.New(repository),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating accrual sources: %w", err)
+	}
+
 	return &App{
-		Config: cfg,
-		DB:     dbPool,
+		Config:  cfg,
+		DB:      dbPool,
+		Accrual: accrual,
 	}, nil
 }
 
-func (app App) Run(ctx context.Context) {
+func (app App) Run(ctx context.Context) error {
 	repository := postgres.New(app.DB)
-	processor := service.NewOrderProcessor(repository, repository)
+	processor := service.NewOrderProcessor(repository, app.Accrual, service.NewAuditService(repository))
 
 	ordersCh := processor.ExtractOrders(ctx)
-	processedCh := service.AccrualWorker(ctx, app.Config.AccrualSystemAddress, ordersCh)
+	processedCh := service.AccrualWorker(ctx, app.Accrual, ordersCh)
 	processor.UpdateOrders(ctx, processedCh)
+
+	service.NewOrderRegistrar(repository, app.Accrual, app.Config).Run(ctx)
+	service.NewIdempotencyService(repository, app.Config).PurgeExpired(ctx)
+
+	return nil
 }
 
 func initDB(url string) (*sql.DB, error) {
@@ -1,41 +1,163 @@
 package app
 
 import (
+	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/handler/account"
+	"github.com/koyif/gophermart/internal/handler/accrual"
+	"github.com/koyif/gophermart/internal/handler/admin"
 	"github.com/koyif/gophermart/internal/handler/balance"
+	"github.com/koyif/gophermart/internal/handler/dashboard"
 	"github.com/koyif/gophermart/internal/handler/middleware"
 	"github.com/koyif/gophermart/internal/handler/order"
+	"github.com/koyif/gophermart/internal/handler/session"
+	"github.com/koyif/gophermart/internal/handler/twofactor"
 	"github.com/koyif/gophermart/internal/handler/user"
+	"github.com/koyif/gophermart/internal/ordernumber"
+	"github.com/koyif/gophermart/internal/password"
 	"github.com/koyif/gophermart/internal/postgres"
 	"github.com/koyif/gophermart/internal/service"
 )
 
-func (app App) Router() *chi.Mux {
+func (app App) Router() (*chi.Mux, error) {
 	r := chi.NewRouter()
 
+	p := postgres.New(app.DB)
+
+	sessionService := service.NewSessionService(p, app.Config)
+	sessionHandler := sessionhandler.New(sessionService)
+
 	r.Use(middleware.WithGzip)
-	r.Use(middleware.WithAuth(app.Config))
 
-	p := postgres.New(app.DB)
-	userService := service.NewUserService(p, app.Config)
+	hasher, err := password.New(app.Config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating password hasher: %w", err)
+	}
+	policy, err := password.NewPolicy(app.Config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating password policy: %w", err)
+	}
+
+	auditService := service.NewAuditService(p)
+
+	numberValidators, err := ordernumber.NewRegistry(app.Config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating order number validators: %w", err)
+	}
+
+	twoFactorService := service.NewTwoFactorService(p, app.Config)
+	twoFactorHandler := twofactorhandler.New(twoFactorService)
+
+	userService := service.NewUserService(p, hasher, policy, twoFactorService, sessionService, auditService)
 	userHandler := userhandler.New(userService)
 
-	balanceService := service.NewBalanceService(p, p)
-	balanceHandler := balancehandler.New(balanceService)
+	accountService := service.NewAccountService(p, hasher, twoFactorService, sessionService)
+	accountHandler := accounthandler.New(accountService)
+
+	balanceService := service.NewBalanceService(p, p, twoFactorService, app.Config.TwoFactorWithdrawalThreshold, auditService)
+	balanceHandler := balancehandler.New(balanceService, numberValidators)
+
+	orderService := service.NewOrderService(p, app.Accrual)
+	orderHandler := orderhandler.New(orderService, numberValidators, app.Config.OrderBatchMaxSize)
+
+	adminService := service.NewAdminService(p, sessionService, auditService)
+	adminHandler := adminhandler.New(adminService)
+
+	idempotencyService := service.NewIdempotencyService(p, app.Config)
+	withIdempotency := middleware.WithIdempotency(idempotencyService)
+	withActiveAccount := middleware.WithActiveAccount(sessionService)
+	withStaff := middleware.WithRoles(sessionService, domain.RoleAdmin, domain.RoleOperator)
+	withAdmin := middleware.WithRoles(sessionService, domain.RoleAdmin)
+
+	pipelineService := service.NewPipelineService(p, app.Config, app.Accrual)
+	dashboardHandler, err := dashboardhandler.New(app.Config, userService, sessionService, adminService, pipelineService)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dashboard handler: %w", err)
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.WithAuth(app.Config, sessionService))
+
+		r.Route("/api/user", func(r chi.Router) {
+			r.Get("/export", accountHandler.Export)
+			r.Delete("/", accountHandler.Delete)
+
+			r.Post("/register", userHandler.Register)
+			r.Post("/login", userHandler.Login)
+			r.Post("/login/2fa", userHandler.LoginTwoFactor)
+			r.Put("/password", userHandler.ChangePassword)
+
+			r.Get("/sessions", sessionHandler.Sessions)
+			r.Delete("/sessions/{id}", sessionHandler.Revoke)
+
+			r.Post("/2fa/enroll", twoFactorHandler.Enroll)
+			r.Post("/2fa/confirm", twoFactorHandler.Confirm)
+			r.Delete("/2fa", twoFactorHandler.Disable)
+
+			r.With(withActiveAccount, withIdempotency).Post("/orders", orderHandler.CreateOrder)
+			r.With(withActiveAccount, withIdempotency).Post("/orders/batch", orderHandler.CreateBatch)
+			r.Get("/orders", orderHandler.Orders)
+			r.Get("/orders/{number}", orderHandler.Order)
+			r.With(withActiveAccount).Delete("/orders/{number}", orderHandler.Cancel)
+			r.Get("/balance", balanceHandler.Balance)
+			r.With(withActiveAccount, withIdempotency).Post("/balance/withdraw", balanceHandler.Withdraw)
+			r.Get("/withdrawals", balanceHandler.Withdrawals)
+		})
+
+		r.Route("/api/admin", func(r chi.Router) {
+			r.Use(withStaff)
+
+			r.Get("/users", adminHandler.SearchUsers)
+			r.Get("/users/{id}", adminHandler.User)
+			r.Get("/users/{id}/orders", adminHandler.Orders)
+			r.Get("/users/{id}/withdrawals", adminHandler.Withdrawals)
+			r.Get("/orders/{number}", adminHandler.Order)
+			r.Post("/orders/{number}/requeue", adminHandler.RequeueOrder)
+			r.Get("/audit", adminHandler.AuditEvents)
+			r.Get("/reward-rules", adminHandler.RewardRules)
+
+			// Operators support users, changing accounts, money and rewards
+			// is up to admins.
+			r.Group(func(r chi.Router) {
+				r.Use(withAdmin)
+
+				r.Put("/users/{id}/status", adminHandler.SetUserStatus)
+				r.Post("/users/{id}/adjustments", adminHandler.AdjustBalance)
+				r.Put("/orders/{number}/owner", adminHandler.ReassignOrder)
+				r.Post("/reward-rules", adminHandler.CreateRewardRule)
+				r.Put("/reward-rules/{id}", adminHandler.UpdateRewardRule)
+				r.Delete("/reward-rules/{id}", adminHandler.DeleteRewardRule)
+			})
+		})
+	})
+
+	if app.Config.AccrualCallbackSecret != "" {
+		processor := service.NewOrderProcessor(p, app.Accrual, auditService)
+		accrualHandler := accrualhandler.New(processor)
+
+		r.With(middleware.WithSignature(app.Config.AccrualCallbackSecret, app.Config.AccrualCallbackMaxSkew)).
+			Post("/api/internal/accrual/callback", accrualHandler.Callback)
+	}
 
-	orderService := service.NewOrderService(p)
-	orderHandler := orderhandler.New(orderService)
+	r.Route("/admin", func(r chi.Router) {
+		r.Get("/login", dashboardHandler.LoginForm)
+		r.Post("/login", dashboardHandler.Login)
+		r.Post("/login/2fa", dashboardHandler.LoginTwoFactor)
 
-	r.Route("/api/user", func(r chi.Router) {
-		r.Post("/register", userHandler.Register)
-		r.Post("/login", userHandler.Login)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.WithCookieAuth(app.Config, sessionService, dashboardhandler.LoginURL))
+			r.Use(withStaff)
+			r.Use(dashboardHandler.WithCSRF)
 
-		r.Post("/orders", orderHandler.CreateOrder)
-		r.Get("/orders", orderHandler.Orders)
-		r.Get("/balance", balanceHandler.Balance)
-		r.Post("/balance/withdraw", balanceHandler.Withdraw)
-		r.Get("/withdrawals", balanceHandler.Withdrawals)
+			r.Get("/", dashboardHandler.Health)
+			r.Get("/users", dashboardHandler.Users)
+			r.Get("/users/{id}", dashboardHandler.User)
+			r.Get("/orders/stuck", dashboardHandler.StuckOrders)
+			r.Post("/orders/{number}/requeue", dashboardHandler.RequeueOrder)
+			r.Post("/logout", dashboardHandler.Logout)
+		})
 	})
 
-	return r
+	return r, nil
 }
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
+	"time"
 )
 
 type Config struct {
@@ -11,7 +12,66 @@ type Config struct {
 	AccrualSystemAddress string   `env:"ACCRUAL_SYSTEM_ADDRESS" env-default:"http://localhost:8080"`
 	DatabaseURL          string   `env:"DATABASE_URI"`
 	PrivateKey           string   `env:"PRIVATE_KEY" env-default:"privatekey"`
-	AuthDisabledURLs     []string `env:"AUTH_DISABLED_URLS" env-default:"/login,/register" env-separator:","`
+	AuthDisabledURLs     []string `env:"AUTH_DISABLED_URLS" env-default:"/api/user/login,/api/user/register,/api/user/login/2fa" env-separator:","`
+
+	PasswordHashAlgorithm string `env:"PASSWORD_HASH_ALGORITHM" env-default:"argon2id"`
+	Argon2Memory          uint32 `env:"ARGON2_MEMORY" env-default:"19456"`
+	Argon2Iterations      uint32 `env:"ARGON2_ITERATIONS" env-default:"2"`
+	Argon2Parallelism     uint8  `env:"ARGON2_PARALLELISM" env-default:"1"`
+	BcryptCost            int    `env:"BCRYPT_COST" env-default:"10"`
+
+	PasswordMinLength       int      `env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+	PasswordRequiredClasses []string `env:"PASSWORD_REQUIRED_CLASSES" env-separator:","`
+	PasswordBlocklistFile   string   `env:"PASSWORD_BLOCKLIST_FILE"`
+
+	TOTPIssuer                   string        `env:"TOTP_ISSUER" env-default:"Gophermart"`
+	TwoFactorChallengeTTL        time.Duration `env:"TWO_FACTOR_CHALLENGE_TTL" env-default:"5m"`
+	TwoFactorWithdrawalThreshold float64       `env:"TWO_FACTOR_WITHDRAWAL_THRESHOLD" env-default:"0"`
+	// After TwoFactorMaxFailures invalid codes in a row no code of the user is
+	// accepted for TwoFactorLockout.
+	TwoFactorMaxFailures int           `env:"TWO_FACTOR_MAX_FAILURES" env-default:"10"`
+	TwoFactorLockout     time.Duration `env:"TWO_FACTOR_LOCKOUT" env-default:"15m"`
+
+	SessionTouchInterval time.Duration `env:"SESSION_TOUCH_INTERVAL" env-default:"30s"`
+
+	StuckOrderAge time.Duration `env:"STUCK_ORDER_AGE" env-default:"1h"`
+
+	OrderBatchMaxSize      int    `env:"ORDER_BATCH_MAX_SIZE" env-default:"1000"`
+	OrderNumberSchemesFile string `env:"ORDER_NUMBER_SCHEMES_FILE"`
+
+	// A request holds its idempotency key for IdempotencyKeyLease while it
+	// runs, the key of a request that never finished is free again after it.
+	IdempotencyKeyTTL   time.Duration `env:"IDEMPOTENCY_KEY_TTL" env-default:"24h"`
+	IdempotencyKeyLease time.Duration `env:"IDEMPOTENCY_KEY_LEASE" env-default:"1m"`
+
+	OrderRegistrationMaxAttempts int `env:"ORDER_REGISTRATION_MAX_ATTEMPTS" env-default:"10"`
+
+	// AccrualSource is http for the external accrual system, rewards for the
+	// built-in rules engine or a provider of AccrualProvidersFile, it defaults
+	// to the default of the file and then to http. AccrualStoreSources
+	// overrides it per store.
+	AccrualSource        string            `env:"ACCRUAL_SOURCE"`
+	AccrualStoreSources  map[string]string `env:"ACCRUAL_STORE_SOURCES" env-separator:","`
+	AccrualProvidersFile string            `env:"ACCRUAL_PROVIDERS_FILE"`
+	// AccrualRateLimit (requests per second of all replicas together, 0 for
+	// none) and AccrualTimeout apply to the http provider at
+	// AccrualSystemAddress.
+	AccrualRateLimit float64       `env:"ACCRUAL_RATE_LIMIT" env-default:"0"`
+	AccrualTimeout   time.Duration `env:"ACCRUAL_TIMEOUT" env-default:"10s"`
+
+	// The http provider is called over mutual TLS with the client certificate
+	// and key, AccrualTLSCAFile replaces the system CAs. The files are read
+	// again when they change.
+	AccrualTLSCertFile   string `env:"ACCRUAL_TLS_CERT_FILE"`
+	AccrualTLSKeyFile    string `env:"ACCRUAL_TLS_KEY_FILE"`
+	AccrualTLSCAFile     string `env:"ACCRUAL_TLS_CA_FILE"`
+	AccrualTLSServerName string `env:"ACCRUAL_TLS_SERVER_NAME"`
+	AccrualTLSMinVersion string `env:"ACCRUAL_TLS_MIN_VERSION" env-default:"1.2"`
+
+	// The callback endpoint of the accrual system is enabled by setting the
+	// secret its requests are signed with.
+	AccrualCallbackSecret  string        `env:"ACCRUAL_CALLBACK_SECRET"`
+	AccrualCallbackMaxSkew time.Duration `env:"ACCRUAL_CALLBACK_MAX_SKEW" env-default:"5m"`
 }
 
 func Load() (*Config, error) {
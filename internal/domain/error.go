@@ -11,4 +11,22 @@ var (
 	ErrWithdrawalExists             = errors.New("withdrawal already exists")
 	ErrWithdrawalAddedByAnotherUser = errors.New("withdrawal added by another user")
 	ErrInsufficientFunds            = errors.New("insufficient funds")
+	ErrPasswordTooLong              = errors.New("password is too long")
+	ErrWeakPassword                 = errors.New("password does not satisfy the policy")
+	ErrTwoFactorAlreadyEnabled      = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnrolled         = errors.New("two-factor authentication is not enrolled")
+	ErrTwoFactorRequired            = errors.New("two-factor code required")
+	ErrInvalidTwoFactorCode         = errors.New("invalid two-factor code")
+	ErrInvalidChallenge             = errors.New("invalid or expired two-factor challenge")
+	ErrTwoFactorLocked              = errors.New("too many invalid two-factor codes, try again later")
+	ErrSessionNotFound              = errors.New("session not found")
+	ErrSessionRevoked               = errors.New("session revoked")
+	ErrAdminExists                  = errors.New("an admin already exists")
+	ErrOrderNotFound                = errors.New("order not found")
+	ErrOrderAlreadyProcessed        = errors.New("order already processed")
+	ErrOrderNotCancellable          = errors.New("order can no longer be cancelled")
+	ErrRewardRuleNotFound           = errors.New("reward rule not found")
+	ErrAccountClosed                = errors.New("account closed")
+	ErrIdempotencyKeyReused         = errors.New("idempotency key reused with a different request")
+	ErrIdempotencyKeyInProgress     = errors.New("a request with this idempotency key is in progress")
 )
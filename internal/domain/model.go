@@ -2,30 +2,322 @@ package domain
 
 import "time"
 
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+)
+
+// A suspended user can still sign in and read their data but can't upload
+// orders or withdraw, a closed one can't sign in at all.
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusClosed    = "closed"
+)
+
 type User struct {
 	ID           int64
 	Login        string
 	Password     string
+	TwoFactor    bool
+	Roles        []string
+	Status       string
 	RegisteredAt time.Time
 }
 
 type Order struct {
-	ID         int64
-	Number     string
-	UserID     int64
-	Status     string
-	Accrual    *float64
-	UploadedAt time.Time
+	ID              int64
+	Number          string
+	UserID          int64
+	Status          string
+	Accrual         *float64
+	UploadedAt      time.Time
+	StatusChangedAt *time.Time
+	LastCheckedAt   *time.Time
+	CheckCount      int64
+	Metadata        OrderMetadata
+	// RegistrationStatus is empty unless the order has been uploaded with
+	// goods, which gophermart registers with the accrual system itself.
+	RegistrationStatus string
+	// AccrualProvider is the name of the accrual provider whose answer last
+	// changed the status of the order, empty until one has.
+	AccrualProvider string
+}
+
+// OrderMetadata describes the purchase an order was uploaded for. All of it is
+// optional, orders uploaded as plain text have none.
+type OrderMetadata struct {
+	StoreID        string
+	PurchaseAmount *float64
+	Currency       string
+	PurchasedAt    *time.Time
+	Goods          []OrderGood
+}
+
+type OrderGood struct {
+	Description string
+	Price       float64
+}
+
+// Registration statuses of an order uploaded with goods.
+const (
+	OrderRegistrationPending    = "PENDING"
+	OrderRegistrationRegistered = "REGISTERED"
+	OrderRegistrationFailed     = "FAILED"
+)
+
+// OrderRegistration is an order waiting to be registered with the accrual
+// system.
+type OrderRegistration struct {
+	OrderID  int64
+	Number   string
+	StoreID  string
+	Goods    []OrderGood
+	Attempts int
+}
+
+// Results of uploading an order as part of a batch.
+const (
+	OrderUploadAccepted        = "accepted"
+	OrderUploadAlreadyUploaded = "already_uploaded"
+	OrderUploadAnotherUser     = "belongs_to_another_user"
+	OrderUploadInvalidNumber   = "invalid_number"
+)
+
+type OrderUpload struct {
+	Number string
+	Result string
+}
+
+// OrderStatusChange is a step of an order through the accrual pipeline.
+// AccrualResponse is the raw answer of the accrual system that caused it, if
+// any.
+type OrderStatusChange struct {
+	Status          string
+	Accrual         *float64
+	AccrualResponse string
+	ChangedAt       time.Time
+}
+
+type OrderDetails struct {
+	Order
+	History []OrderStatusChange
+}
+
+// AccrualCheck is the answer of the accrual system about an order. Status is
+// empty if the accrual system doesn't know the order yet.
+type AccrualCheck struct {
+	Order    Order
+	Status   string
+	Accrual  *float64
+	Response string
+	Provider string
 }
 
 type Withdrawal struct {
+	ID          int64
 	UserID      int64
 	OrderNumber string
 	Amount      float64
 	ProcessedAt time.Time
 }
 
+const (
+	BalanceChangeAccrual    = "ACCRUAL"
+	BalanceChangeWithdrawal = "WITHDRAWAL"
+	BalanceChangeAdjustment = "ADJUSTMENT"
+)
+
+// BalanceChange is an entry of the balance ledger, Amount is negative for debits.
+type BalanceChange struct {
+	UserID    int64
+	Kind      string
+	Amount    float64
+	Reference string
+	CreatedAt time.Time
+}
+
 type Balance struct {
 	Current   float64
 	Withdrawn float64
 }
+
+type TwoFactor struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+	// Locked is set while codes of the user aren't accepted after too many
+	// failed ones.
+	Locked bool
+}
+
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+type TwoFactorChallenge struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// LoginResult holds either a token or, when the user has two-factor
+// authentication enabled, the challenge that has to be completed to get one.
+type LoginResult struct {
+	Token     string
+	Challenge *TwoFactorChallenge
+}
+
+// ClientInfo describes the client a request came from.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+type Session struct {
+	ID         string
+	UserID     int64
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+type AccountExport struct {
+	User           User
+	Balance        Balance
+	Orders         []Order
+	Withdrawals    []Withdrawal
+	BalanceHistory []BalanceChange
+	Sessions       []Session
+}
+
+// UserSummary is what support staff see about a user.
+type UserSummary struct {
+	User
+	Balance Balance
+	Deleted bool
+}
+
+// AdminAction records who did what through the admin API.
+type AdminAction struct {
+	AdminID    int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Reason     string
+	Details    string
+}
+
+// AccrualStats sums up the counters of all accrual providers, BackoffUntil is
+// the latest backoff among them.
+type AccrualStats struct {
+	Requests     int64
+	Errors       int64
+	RateLimited  int64
+	BackoffUntil time.Time
+	Providers    []AccrualProviderStats
+}
+
+type AccrualProviderStats struct {
+	Name         string
+	Requests     int64
+	Errors       int64
+	RateLimited  int64
+	BackoffUntil time.Time
+}
+
+type PipelineHealth struct {
+	OrdersByStatus map[string]int64
+	StuckOrders    int64
+	Accrual        AccrualStats
+}
+
+const (
+	AuditOutcomeSuccess    = "success"
+	AuditOutcomeFailure    = "failure"
+	AuditOutcomeChallenged = "challenged"
+)
+
+// AuditEvent is an entry of the append-only security log. ActorID is nil when
+// the actor is unknown (e.g. a failed login) or the system itself.
+type AuditEvent struct {
+	ID         int64
+	OccurredAt time.Time
+	ActorID    *int64
+	IP         string
+	Type       string
+	TargetType string
+	TargetID   string
+	Outcome    string
+	Reason     string
+	Details    string
+}
+
+// AuditFilter narrows down audit events, zero values match everything.
+type AuditFilter struct {
+	ActorID    *int64
+	Type       string
+	TargetType string
+	TargetID   string
+	Outcome    string
+	From       time.Time
+	To         time.Time
+	Limit      int
+	Offset     int
+}
+
+const (
+	SortDesc = "desc"
+	SortAsc  = "asc"
+)
+
+// Cursor points at the last item of a page by its timestamp and ID, the next
+// page starts right after it in the requested order.
+type Cursor struct {
+	At time.Time
+	ID int64
+}
+
+// ListQuery selects a page of a user's orders or withdrawals. Zero values of
+// Status, From and To don't filter anything, a zero Limit selects all of them.
+type ListQuery struct {
+	Limit  int
+	After  *Cursor
+	Sort   string
+	Status string
+	From   time.Time
+	To     time.Time
+}
+
+// IdempotentResponse is the stored outcome of a request made with an
+// Idempotency-Key. StatusCode is 0 while the first request is in progress.
+type IdempotentResponse struct {
+	RequestHash string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// Reward types of a rule of the rewards engine.
+const (
+	RewardPercent = "percent"
+	RewardFixed   = "fixed"
+)
+
+// RewardRule is a rule of the built-in rewards engine. An empty StoreID or
+// Match matches any store or good, a nil ValidFrom or ValidTo leaves the date
+// window open on that side. Reward is a percentage of the price of a matching
+// good or a fixed number of points per good, depending on RewardType.
+type RewardRule struct {
+	ID         int64
+	Name       string
+	StoreID    string
+	Match      string
+	RewardType string
+	Reward     float64
+	ValidFrom  *time.Time
+	ValidTo    *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
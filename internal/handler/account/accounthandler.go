@@ -0,0 +1,171 @@
+package accounthandler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/dto"
+	"github.com/koyif/gophermart/pkg/logger"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type accountService interface {
+	Export(userID int64) (*domain.AccountExport, error)
+	Delete(userID int64, currentPassword, code string) error
+}
+
+type AccountHandler struct {
+	srv accountService
+}
+
+func New(srv accountService) *AccountHandler {
+	return &AccountHandler{
+		srv: srv,
+	}
+}
+
+func (h AccountHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userIDHeader := r.Header.Get("User-ID")
+	userID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	export, err := h.srv.Export(userID)
+	if err != nil {
+		logger.Log.Error("error while exporting account", logger.Int64("user_id", userID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.AccountExport{
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Profile: dto.Profile{
+			ID:               export.User.ID,
+			Login:            export.User.Login,
+			RegisteredAt:     export.User.RegisteredAt.Format(time.RFC3339),
+			TwoFactorEnabled: export.User.TwoFactor,
+		},
+		Balance: dto.Balance{
+			Current:   export.Balance.Current,
+			Withdrawn: export.Balance.Withdrawn,
+		},
+		Orders:         make([]dto.Order, len(export.Orders)),
+		Withdrawals:    make([]dto.Withdrawal, len(export.Withdrawals)),
+		BalanceHistory: make([]dto.BalanceChange, len(export.BalanceHistory)),
+		Sessions:       make([]dto.Session, len(export.Sessions)),
+	}
+	for i, order := range export.Orders {
+		resp.Orders[i] = toOrder(order)
+	}
+	for i, withdrawal := range export.Withdrawals {
+		resp.Withdrawals[i] = dto.Withdrawal{
+			Order:       withdrawal.OrderNumber,
+			Sum:         withdrawal.Amount,
+			ProcessedAt: withdrawal.ProcessedAt.Format(time.RFC3339),
+		}
+	}
+	for i, change := range export.BalanceHistory {
+		resp.BalanceHistory[i] = dto.BalanceChange{
+			Kind:      change.Kind,
+			Amount:    change.Amount,
+			Reference: change.Reference,
+			CreatedAt: change.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	for i, session := range export.Sessions {
+		resp.Sessions[i] = dto.Session{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt.Format(time.RFC3339),
+			LastSeenAt: session.LastSeenAt.Format(time.RFC3339),
+			Current:    session.ID == r.Header.Get("Session-ID"),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="gophermart-export.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		logger.Log.Error("error while encoding account export to JSON", logger.Int64("user_id", userID), logger.Error(err))
+		return
+	}
+}
+
+func (h AccountHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userIDHeader := r.Header.Get("User-ID")
+	userID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	var req dto.AccountDeletion
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Log.Warn("error while decoding an account deletion request")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	defer func(body io.ReadCloser) {
+		err := body.Close()
+		if err != nil {
+			logger.Log.Error("error while closing request body", logger.Error(err))
+			return
+		}
+	}(r.Body)
+
+	if err := req.IsValid(); err != nil {
+		logger.Log.Warn("invalid account deletion fields", logger.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.srv.Delete(userID, req.Password, req.Code)
+	if err != nil {
+		if errors.Is(err, domain.ErrIncorrectCredentials) {
+			http.Error(w, "incorrect password", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, domain.ErrTwoFactorRequired) || errors.Is(err, domain.ErrInvalidTwoFactorCode) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, domain.ErrTwoFactorLocked) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		logger.Log.Error("error while deleting account", logger.Int64("user_id", userID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toOrder(order domain.Order) dto.Order {
+	resp := dto.Order{
+		Number:             order.Number,
+		Status:             order.Status,
+		Accrual:            order.Accrual,
+		UploadedAt:         order.UploadedAt.Format(time.RFC3339),
+		StoreID:            order.Metadata.StoreID,
+		PurchaseAmount:     order.Metadata.PurchaseAmount,
+		Currency:           order.Metadata.Currency,
+		RegistrationStatus: order.RegistrationStatus,
+	}
+	if order.Metadata.PurchasedAt != nil {
+		resp.PurchasedAt = order.Metadata.PurchasedAt.Format(time.RFC3339)
+	}
+
+	return resp
+}
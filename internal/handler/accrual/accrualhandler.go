@@ -0,0 +1,69 @@
+package accrualhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/dto"
+	"github.com/koyif/gophermart/pkg/logger"
+	"io"
+	"net/http"
+)
+
+type orderProcessor interface {
+	ApplyCallback(number, status string, accrual *float64, response string) (bool, error)
+}
+
+// AccrualHandler receives the answers the accrual system pushes to us, see
+// middleware.WithSignature for how they are authenticated.
+type AccrualHandler struct {
+	processor orderProcessor
+}
+
+func New(processor orderProcessor) *AccrualHandler {
+	return &AccrualHandler{
+		processor: processor,
+	}
+}
+
+// Callback applies a dto.AccrualResponse to the order. A callback that
+// doesn't change anything, e.g. a replayed one, is accepted as well.
+func (h AccrualHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.Log.Warn("error while reading request body")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var req dto.AccrualResponse
+	if err = json.Unmarshal(raw, &req); err != nil {
+		logger.Log.Warn("error while decoding accrual callback", logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if err = req.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	applied, err := h.processor.ApplyCallback(req.Order, req.Status, req.Accrual, string(raw))
+	if err != nil {
+		if errors.Is(err, domain.ErrOrderNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		logger.Log.Error("error while applying accrual callback", logger.String("number", req.Order), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.Info(
+		"accrual callback received",
+		logger.String("number", req.Order),
+		logger.String("status", req.Status),
+		logger.Bool("applied", applied),
+	)
+	w.WriteHeader(http.StatusOK)
+}
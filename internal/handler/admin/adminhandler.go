@@ -0,0 +1,540 @@
+package adminhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/handler/client"
+	"github.com/koyif/gophermart/pkg/dto"
+	"github.com/koyif/gophermart/pkg/logger"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+	defaultAuditLimit  = 100
+	maxAuditLimit      = 1000
+)
+
+type adminService interface {
+	SearchUsers(adminID int64, login string, limit, offset int) ([]domain.UserSummary, error)
+	User(adminID, userID int64) (*domain.UserSummary, error)
+	Orders(adminID, userID int64) ([]domain.Order, error)
+	Withdrawals(adminID, userID int64) ([]domain.Withdrawal, error)
+	Order(adminID int64, number string) (*domain.OrderDetails, error)
+	RequeueOrder(adminID int64, number, reason string) error
+	ReassignOrder(adminID int64, number string, userID int64, reason string) error
+	AdjustBalance(adminID, userID int64, amount float64, reason string, client domain.ClientInfo) (*domain.Balance, error)
+	AuditEvents(adminID int64, filter domain.AuditFilter) ([]domain.AuditEvent, error)
+	SetUserStatus(adminID, userID int64, status, reason string) error
+	RewardRules(adminID int64) ([]domain.RewardRule, error)
+	CreateRewardRule(adminID int64, rule domain.RewardRule) (*domain.RewardRule, error)
+	UpdateRewardRule(adminID int64, rule domain.RewardRule) (*domain.RewardRule, error)
+	DeleteRewardRule(adminID, ruleID int64) error
+}
+
+type AdminHandler struct {
+	srv adminService
+}
+
+func New(srv adminService) *AdminHandler {
+	return &AdminHandler{
+		srv: srv,
+	}
+}
+
+func (h AdminHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultSearchLimit)
+	if err != nil || limit <= 0 || limit > maxSearchLimit {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	users, err := h.srv.SearchUsers(adminID, r.URL.Query().Get("login"), limit, offset)
+	if err != nil {
+		logger.Log.Error("error while searching users", logger.Int64("admin_id", adminID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	dtos := make([]dto.AdminUser, len(users))
+	for i, user := range users {
+		dtos[i] = toAdminUser(user)
+	}
+
+	writeJSON(w, http.StatusOK, dtos)
+}
+
+func (h AdminHandler) User(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.srv.User(adminID, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		logger.Log.Error("error while fetching user", logger.Int64("admin_id", adminID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toAdminUser(*user))
+}
+
+func (h AdminHandler) Orders(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	orders, err := h.srv.Orders(adminID, userID)
+	if err != nil {
+		logger.Log.Error("error while fetching orders", logger.Int64("admin_id", adminID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	dtos := make([]dto.Order, len(orders))
+	for i, order := range orders {
+		dtos[i] = toOrder(order)
+	}
+
+	writeJSON(w, http.StatusOK, dtos)
+}
+
+func (h AdminHandler) Withdrawals(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	withdrawals, err := h.srv.Withdrawals(adminID, userID)
+	if err != nil {
+		logger.Log.Error("error while fetching withdrawals", logger.Int64("admin_id", adminID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	dtos := make([]dto.Withdrawal, len(withdrawals))
+	for i, withdrawal := range withdrawals {
+		dtos[i] = dto.Withdrawal{
+			Order:       withdrawal.OrderNumber,
+			Sum:         withdrawal.Amount,
+			ProcessedAt: withdrawal.ProcessedAt.Format(time.RFC3339),
+		}
+	}
+
+	writeJSON(w, http.StatusOK, dtos)
+}
+
+func (h AdminHandler) Order(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+
+	number := chi.URLParam(r, "number")
+	order, err := h.srv.Order(adminID, number)
+	if err != nil {
+		if errors.Is(err, domain.ErrOrderNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		logger.Log.Error("error while fetching order", logger.Int64("admin_id", adminID), logger.String("number", number), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.AdminOrder{
+		OrderDetails: dto.OrderDetails{
+			Order:      toOrder(order.Order),
+			CheckCount: order.CheckCount,
+			Goods:      toGoods(order.Metadata.Goods),
+			History:    make([]dto.OrderStatusChange, len(order.History)),
+		},
+		UserID:          order.UserID,
+		AccrualProvider: order.AccrualProvider,
+	}
+	if order.LastCheckedAt != nil {
+		lastCheckedAt := order.LastCheckedAt.Format(time.RFC3339)
+		resp.LastCheckedAt = &lastCheckedAt
+	}
+	for i, change := range order.History {
+		resp.History[i] = dto.OrderStatusChange{
+			Status:    change.Status,
+			Accrual:   change.Accrual,
+			ChangedAt: change.ChangedAt.Format(time.RFC3339),
+		}
+		if change.AccrualResponse != "" {
+			resp.History[i].AccrualResponse = json.RawMessage(change.AccrualResponse)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h AdminHandler) RequeueOrder(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+
+	var req dto.AdminReason
+	if !decode(w, r, &req) {
+		return
+	}
+	if err := req.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	number := chi.URLParam(r, "number")
+	err := h.srv.RequeueOrder(adminID, number, req.Reason)
+	if err != nil {
+		if errors.Is(err, domain.ErrOrderNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, domain.ErrOrderAlreadyProcessed) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		logger.Log.Error("error while requeueing order", logger.Int64("admin_id", adminID), logger.String("number", number), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ReassignOrder moves an order to another user.
+func (h AdminHandler) ReassignOrder(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+
+	var req dto.OrderOwner
+	if !decode(w, r, &req) {
+		return
+	}
+	if err := req.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	number := chi.URLParam(r, "number")
+	err := h.srv.ReassignOrder(adminID, number, req.UserID, req.Reason)
+	if err != nil {
+		if errors.Is(err, domain.ErrOrderNotFound) || errors.Is(err, domain.ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, domain.ErrOrderAlreadyProcessed) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		logger.Log.Error("error while reassigning order", logger.Int64("admin_id", adminID), logger.String("number", number), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h AdminHandler) SetUserStatus(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req dto.UserStatus
+	if !decode(w, r, &req) {
+		return
+	}
+	if err := req.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.srv.SetUserStatus(adminID, userID, req.Status, req.Reason)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		logger.Log.Error("error while changing user status", logger.Int64("admin_id", adminID), logger.Int64("user_id", userID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h AdminHandler) AdjustBalance(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req dto.BalanceAdjustment
+	if !decode(w, r, &req) {
+		return
+	}
+	if err := req.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	balance, err := h.srv.AdjustBalance(adminID, userID, req.Amount, req.Reason, client.Info(r))
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, domain.ErrInsufficientFunds) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		logger.Log.Error("error while adjusting balance", logger.Int64("admin_id", adminID), logger.Int64("user_id", userID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dto.Balance{
+		Current:   balance.Current,
+		Withdrawn: balance.Withdrawn,
+	})
+}
+
+// AuditEvents returns the security log, newest first. Filters: actor_id,
+// event_type, target_type, target_id, outcome and an RFC 3339 from/to range.
+func (h AdminHandler) AuditEvents(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := domain.AuditFilter{
+		Type:       query.Get("event_type"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+		Outcome:    query.Get("outcome"),
+	}
+
+	var err error
+	if filter.Limit, err = queryInt(r, "limit", defaultAuditLimit); err != nil || filter.Limit <= 0 || filter.Limit > maxAuditLimit {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	if filter.Offset, err = queryInt(r, "offset", 0); err != nil || filter.Offset < 0 {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+	if value := query.Get("actor_id"); value != "" {
+		actorID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid actor_id", http.StatusBadRequest)
+			return
+		}
+		filter.ActorID = &actorID
+	}
+	if filter.From, err = queryTime(r, "from"); err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = queryTime(r, "to"); err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.srv.AuditEvents(adminID, filter)
+	if err != nil {
+		logger.Log.Error("error while fetching audit events", logger.Int64("admin_id", adminID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	dtos := make([]dto.AuditEvent, len(events))
+	for i, event := range events {
+		dtos[i] = dto.AuditEvent{
+			ID:         event.ID,
+			OccurredAt: event.OccurredAt.Format(time.RFC3339),
+			ActorID:    event.ActorID,
+			IP:         event.IP,
+			Type:       event.Type,
+			TargetType: event.TargetType,
+			TargetID:   event.TargetID,
+			Outcome:    event.Outcome,
+			Reason:     event.Reason,
+		}
+		if event.Details != "" {
+			dtos[i].Details = json.RawMessage(event.Details)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, dtos)
+}
+
+func toAdminUser(user domain.UserSummary) dto.AdminUser {
+	roles := user.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+
+	return dto.AdminUser{
+		ID:               user.ID,
+		Login:            user.Login,
+		Roles:            roles,
+		Status:           user.Status,
+		TwoFactorEnabled: user.TwoFactor,
+		Deleted:          user.Deleted,
+		RegisteredAt:     user.RegisteredAt.Format(time.RFC3339),
+		Balance: dto.Balance{
+			Current:   user.Balance.Current,
+			Withdrawn: user.Balance.Withdrawn,
+		},
+	}
+}
+
+func adminIDFromHeader(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userIDHeader := r.Header.Get("User-ID")
+	adminID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return 0, false
+	}
+
+	return adminID, true
+}
+
+func userIDFromPath(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return userID, true
+}
+
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+func queryTime(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	defer func(body io.ReadCloser) {
+		err := body.Close()
+		if err != nil {
+			logger.Log.Error("error while closing request body", logger.Error(err))
+		}
+	}(r.Body)
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		logger.Log.Warn("error while decoding an admin request", logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Log.Error("error while encoding response to JSON", logger.Error(err))
+	}
+}
+
+func toOrder(order domain.Order) dto.Order {
+	resp := dto.Order{
+		Number:             order.Number,
+		Status:             order.Status,
+		Accrual:            order.Accrual,
+		UploadedAt:         order.UploadedAt.Format(time.RFC3339),
+		StoreID:            order.Metadata.StoreID,
+		PurchaseAmount:     order.Metadata.PurchaseAmount,
+		Currency:           order.Metadata.Currency,
+		RegistrationStatus: order.RegistrationStatus,
+	}
+	if order.Metadata.PurchasedAt != nil {
+		resp.PurchasedAt = order.Metadata.PurchasedAt.Format(time.RFC3339)
+	}
+
+	return resp
+}
+
+func toGoods(goods []domain.OrderGood) []dto.OrderGood {
+	if len(goods) == 0 {
+		return nil
+	}
+
+	dtos := make([]dto.OrderGood, len(goods))
+	for i, good := range goods {
+		dtos[i] = dto.OrderGood(good)
+	}
+
+	return dtos
+}
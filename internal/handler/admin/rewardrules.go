@@ -0,0 +1,164 @@
+package adminhandler
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/dto"
+	"github.com/koyif/gophermart/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RewardRules lists the rules of the built-in rewards engine.
+func (h AdminHandler) RewardRules(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := h.srv.RewardRules(adminID)
+	if err != nil {
+		logger.Log.Error("error while fetching reward rules", logger.Int64("admin_id", adminID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	dtos := make([]dto.RewardRule, len(rules))
+	for i, rule := range rules {
+		dtos[i] = toRewardRule(rule)
+	}
+
+	writeJSON(w, http.StatusOK, dtos)
+}
+
+func (h AdminHandler) CreateRewardRule(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+
+	rule, ok := decodeRewardRule(w, r)
+	if !ok {
+		return
+	}
+
+	created, err := h.srv.CreateRewardRule(adminID, rule)
+	if err != nil {
+		logger.Log.Error("error while creating reward rule", logger.Int64("admin_id", adminID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toRewardRule(*created))
+}
+
+func (h AdminHandler) UpdateRewardRule(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+	ruleID, ok := ruleIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	rule, ok := decodeRewardRule(w, r)
+	if !ok {
+		return
+	}
+	rule.ID = ruleID
+
+	updated, err := h.srv.UpdateRewardRule(adminID, rule)
+	if err != nil {
+		if errors.Is(err, domain.ErrRewardRuleNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		logger.Log.Error("error while updating reward rule", logger.Int64("admin_id", adminID), logger.Int64("rule_id", ruleID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toRewardRule(*updated))
+}
+
+func (h AdminHandler) DeleteRewardRule(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := adminIDFromHeader(w, r)
+	if !ok {
+		return
+	}
+	ruleID, ok := ruleIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.srv.DeleteRewardRule(adminID, ruleID)
+	if err != nil {
+		if errors.Is(err, domain.ErrRewardRuleNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		logger.Log.Error("error while deleting reward rule", logger.Int64("admin_id", adminID), logger.Int64("rule_id", ruleID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeRewardRule(w http.ResponseWriter, r *http.Request) (domain.RewardRule, bool) {
+	var req dto.RewardRule
+	if !decode(w, r, &req) {
+		return domain.RewardRule{}, false
+	}
+	if err := req.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return domain.RewardRule{}, false
+	}
+
+	rule := domain.RewardRule{
+		Name:       req.Name,
+		StoreID:    req.StoreID,
+		Match:      req.Match,
+		RewardType: req.RewardType,
+		Reward:     req.Reward,
+	}
+	if req.ValidFrom != nil {
+		validFrom := req.ValidFrom.UTC()
+		rule.ValidFrom = &validFrom
+	}
+	if req.ValidTo != nil {
+		validTo := req.ValidTo.UTC()
+		rule.ValidTo = &validTo
+	}
+
+	return rule, true
+}
+
+func ruleIDFromPath(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	ruleID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid rule ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return ruleID, true
+}
+
+func toRewardRule(rule domain.RewardRule) dto.RewardRule {
+	return dto.RewardRule{
+		ID:         rule.ID,
+		Name:       rule.Name,
+		StoreID:    rule.StoreID,
+		Match:      rule.Match,
+		RewardType: rule.RewardType,
+		Reward:     rule.Reward,
+		ValidFrom:  rule.ValidFrom,
+		ValidTo:    rule.ValidTo,
+		UpdatedAt:  rule.UpdatedAt.Format(time.RFC3339),
+	}
+}
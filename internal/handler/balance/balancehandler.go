@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/handler/client"
+	"github.com/koyif/gophermart/internal/handler/pagination"
+	"github.com/koyif/gophermart/internal/ordernumber"
 	"github.com/koyif/gophermart/pkg/dto"
 	"github.com/koyif/gophermart/pkg/logger"
-	"github.com/theplant/luhn"
 	"net/http"
 	"strconv"
 	"time"
@@ -14,17 +16,26 @@ import (
 
 type balanceService interface {
 	Balance(userID int64) (*domain.Balance, error)
-	Withdraw(orderNumber string, sum float64, userID int64) error
-	Withdrawals(userID int64) ([]domain.Withdrawal, error)
+	Withdraw(orderNumber string, sum float64, userID int64, totpCode string, client domain.ClientInfo) error
+	Withdrawals(userID int64, query domain.ListQuery) ([]domain.Withdrawal, *domain.Cursor, error)
+}
+
+// numberValidator picks the order number scheme by the store of an order and
+// the number itself. Withdrawals have no store, their numbers are validated
+// by prefix.
+type numberValidator interface {
+	Validate(storeID, number string) error
 }
 
 type BalanceHandler struct {
 	balanceService balanceService
+	numbers        numberValidator
 }
 
-func New(svc balanceService) *BalanceHandler {
+func New(svc balanceService, numbers numberValidator) *BalanceHandler {
 	return &BalanceHandler{
 		balanceService: svc,
+		numbers:        numbers,
 	}
 }
 
@@ -75,21 +86,29 @@ func (h BalanceHandler) Withdraw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orderNumber, err := strconv.ParseInt(withdrawalRequest.Order, 10, 64)
-	if err != nil {
-		logger.Log.Warn("invalid order ID", logger.Error(err))
+	if err = h.numbers.Validate("", withdrawalRequest.Order); err != nil {
+		if errors.Is(err, ordernumber.ErrInvalidNumber) {
+			logger.Log.Warn("invalid order number", logger.String("number", withdrawalRequest.Order))
+			http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
+			return
+		}
+		logger.Log.Warn("malformed order number", logger.Error(err))
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	if ok := luhn.Valid(int(orderNumber)); !ok {
-		logger.Log.Warn("invalid order ID, Luhn check failed", logger.Int64("orderNumber", orderNumber))
-		http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
-		return
-	}
-
-	err = h.balanceService.Withdraw(withdrawalRequest.Order, withdrawalRequest.Sum, userID)
+	err = h.balanceService.Withdraw(withdrawalRequest.Order, withdrawalRequest.Sum, userID, r.Header.Get("X-TOTP-Code"), client.Info(r))
 	if err != nil {
+		if errors.Is(err, domain.ErrTwoFactorRequired) || errors.Is(err, domain.ErrInvalidTwoFactorCode) {
+			logger.Log.Warn("withdrawal rejected by two-factor check", logger.Int64("user_id", userID), logger.Error(err))
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, domain.ErrTwoFactorLocked) {
+			logger.Log.Warn("withdrawal rejected by two-factor lockout", logger.Int64("user_id", userID))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
 		if errors.Is(err, domain.ErrInsufficientFunds) {
 			logger.Log.Warn("insufficient funds", logger.Int64("user_id", userID))
 			http.Error(w, "insufficient funds", http.StatusPaymentRequired)
@@ -120,7 +139,13 @@ func (h BalanceHandler) Withdrawals(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	withdrawals, err := h.balanceService.Withdrawals(userID)
+	query, err := pagination.ParseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	withdrawals, next, err := h.balanceService.Withdrawals(userID, query)
 	if err != nil {
 		logger.Log.Error("error while fetching withdrawals", logger.Int64("user_id", userID), logger.Error(err))
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -136,6 +161,7 @@ func (h BalanceHandler) Withdrawals(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	pagination.SetNext(w, r, next)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(dtos)
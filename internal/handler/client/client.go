@@ -0,0 +1,21 @@
+package client
+
+import (
+	"github.com/koyif/gophermart/internal/domain"
+	"net"
+	"net/http"
+)
+
+// Info describes the client a request comes from for sessions and the audit
+// log.
+func Info(r *http.Request) domain.ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return domain.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IP:        ip,
+	}
+}
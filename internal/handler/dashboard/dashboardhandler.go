@@ -0,0 +1,500 @@
+package dashboardhandler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/koyif/gophermart/internal/config"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/handler/client"
+	"github.com/koyif/gophermart/internal/handler/middleware"
+	"github.com/koyif/gophermart/internal/token"
+	"github.com/koyif/gophermart/pkg/logger"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LoginURL = "/admin/login"
+
+	cookiePath       = "/admin"
+	csrfCookieName   = "gophermart_csrf"
+	csrfFieldName    = "csrf_token"
+	searchLimit      = 50
+	stuckOrdersLimit = 200
+)
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+var pageNames = []string{"login", "login_2fa", "health", "users", "user", "stuck"}
+
+type authService interface {
+	Login(login, password string, client domain.ClientInfo) (*domain.LoginResult, error)
+	CompleteLogin(challengeID, code string, client domain.ClientInfo) (string, error)
+}
+
+type sessionService interface {
+	Revoke(userID int64, sessionID string) error
+}
+
+type adminService interface {
+	SearchUsers(adminID int64, login string, limit, offset int) ([]domain.UserSummary, error)
+	User(adminID, userID int64) (*domain.UserSummary, error)
+	Orders(adminID, userID int64) ([]domain.Order, error)
+	Withdrawals(adminID, userID int64) ([]domain.Withdrawal, error)
+	RequeueOrder(adminID int64, number, reason string) error
+}
+
+type pipelineService interface {
+	Health() (*domain.PipelineHealth, error)
+	StuckOrders(limit int) ([]domain.Order, error)
+}
+
+type page struct {
+	Title         string
+	Authenticated bool
+	CSRFToken     string
+	Flash         string
+	Error         string
+	Data          any
+}
+
+// DashboardHandler serves the browser UI for support staff. The token is kept
+// in an HttpOnly cookie scoped to /admin, every form carries a CSRF token:
+// before login it is a random value mirrored in a cookie, after login it is
+// derived from the session ID.
+type DashboardHandler struct {
+	config   *config.Config
+	auth     authService
+	sessions sessionService
+	admin    adminService
+	pipeline pipelineService
+	pages    map[string]*template.Template
+}
+
+func New(
+	cfg *config.Config,
+	auth authService,
+	sessions sessionService,
+	admin adminService,
+	pipeline pipelineService,
+) (*DashboardHandler, error) {
+	funcs := template.FuncMap{
+		"money": func(v float64) string {
+			return strconv.FormatFloat(v, 'f', 2, 64)
+		},
+		"datetime": func(t time.Time) string {
+			return t.Format(time.DateTime)
+		},
+		"percent": func(part, total int64) string {
+			if total == 0 {
+				return "0%"
+			}
+			return fmt.Sprintf("%.1f%%", float64(part)*100/float64(total))
+		},
+		"join": func(values []string) string {
+			return strings.Join(values, ", ")
+		},
+		"deref": func(v *float64) float64 {
+			return *v
+		},
+		"requeue": func(number, csrfToken, returnTo string) map[string]string {
+			return map[string]string{"Number": number, "CSRFToken": csrfToken, "ReturnTo": returnTo}
+		},
+	}
+
+	pages := make(map[string]*template.Template, len(pageNames))
+	for _, name := range pageNames {
+		t, err := template.New(name).Funcs(funcs).ParseFS(
+			templatesFS,
+			"templates/layout.html",
+			"templates/requeue.html",
+			"templates/"+name+".html",
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template %s: %w", name, err)
+		}
+		pages[name] = t
+	}
+
+	return &DashboardHandler{
+		config:   cfg,
+		auth:     auth,
+		sessions: sessions,
+		admin:    admin,
+		pipeline: pipeline,
+		pages:    pages,
+	}, nil
+}
+
+func (h DashboardHandler) LoginForm(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, http.StatusOK, "login", page{Title: "Sign in", CSRFToken: h.preAuthCSRFToken(w, r)})
+}
+
+func (h DashboardHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if !h.checkPreAuthCSRF(w, r) {
+		return
+	}
+
+	result, err := h.auth.Login(r.PostForm.Get("login"), r.PostForm.Get("password"), client.Info(r))
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Something went wrong, try again later."
+		if errors.Is(err, domain.ErrIncorrectCredentials) {
+			status, message = http.StatusUnauthorized, "Incorrect login or password."
+		} else if errors.Is(err, domain.ErrAccountClosed) {
+			status, message = http.StatusForbidden, "This account has been closed."
+		} else if errors.Is(err, domain.ErrTwoFactorLocked) {
+			status, message = http.StatusTooManyRequests, "Too many invalid codes, try again later."
+		} else {
+			logger.Log.Error("error while logging in to the dashboard", logger.Error(err))
+		}
+		h.render(w, r, status, "login", page{Title: "Sign in", CSRFToken: h.preAuthCSRFToken(w, r), Error: message})
+		return
+	}
+
+	if result.Challenge != nil {
+		h.render(w, r, http.StatusOK, "login_2fa", page{
+			Title:     "Two-factor authentication",
+			CSRFToken: h.preAuthCSRFToken(w, r),
+			Data:      result.Challenge.ID,
+		})
+		return
+	}
+
+	h.startSession(w, r, result.Token)
+}
+
+func (h DashboardHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if !h.checkPreAuthCSRF(w, r) {
+		return
+	}
+
+	challenge := r.PostForm.Get("challenge")
+	t, err := h.auth.CompleteLogin(challenge, r.PostForm.Get("code"), client.Info(r))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidTwoFactorCode) {
+			h.render(w, r, http.StatusUnauthorized, "login_2fa", page{
+				Title:     "Two-factor authentication",
+				CSRFToken: h.preAuthCSRFToken(w, r),
+				Error:     "Invalid code.",
+				Data:      challenge,
+			})
+			return
+		}
+
+		status, message := http.StatusInternalServerError, "Something went wrong, try again later."
+		if errors.Is(err, domain.ErrInvalidChallenge) {
+			status, message = http.StatusUnauthorized, "The sign in attempt has expired, start again."
+		} else if errors.Is(err, domain.ErrTwoFactorLocked) {
+			status, message = http.StatusTooManyRequests, "Too many invalid codes, try again later."
+		} else {
+			logger.Log.Error("error while completing dashboard two-factor login", logger.Error(err))
+		}
+		h.render(w, r, status, "login", page{Title: "Sign in", CSRFToken: h.preAuthCSRFToken(w, r), Error: message})
+		return
+	}
+
+	h.startSession(w, r, t)
+}
+
+func (h DashboardHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.Header.Get("User-ID"), 10, 64)
+	if err == nil {
+		if err = h.sessions.Revoke(userID, r.Header.Get("Session-ID")); err != nil && !errors.Is(err, domain.ErrSessionNotFound) {
+			logger.Log.Error("error while revoking dashboard session", logger.Int64("user_id", userID), logger.Error(err))
+		}
+	}
+
+	h.setCookie(w, r, middleware.AuthCookieName, "", -1)
+	http.Redirect(w, r, LoginURL, http.StatusSeeOther)
+}
+
+func (h DashboardHandler) Health(w http.ResponseWriter, r *http.Request) {
+	health, err := h.pipeline.Health()
+	if err != nil {
+		logger.Log.Error("error while fetching pipeline health", logger.Error(err))
+		h.renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	h.render(w, r, http.StatusOK, "health", h.authenticatedPage(r, "Pipeline health", health))
+}
+
+func (h DashboardHandler) Users(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := h.adminID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query().Get("login")
+	users, err := h.admin.SearchUsers(adminID, query, searchLimit, 0)
+	if err != nil {
+		logger.Log.Error("error while searching users", logger.Int64("admin_id", adminID), logger.Error(err))
+		h.renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	h.render(w, r, http.StatusOK, "users", h.authenticatedPage(r, "Users", struct {
+		Query string
+		Users []domain.UserSummary
+	}{query, users}))
+}
+
+func (h DashboardHandler) User(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := h.adminID(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.renderError(w, r, http.StatusNotFound)
+		return
+	}
+
+	user, err := h.admin.User(adminID, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			h.renderError(w, r, http.StatusNotFound)
+			return
+		}
+		logger.Log.Error("error while fetching user", logger.Int64("admin_id", adminID), logger.Error(err))
+		h.renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	orders, err := h.admin.Orders(adminID, userID)
+	if err != nil {
+		logger.Log.Error("error while fetching orders", logger.Int64("admin_id", adminID), logger.Error(err))
+		h.renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	withdrawals, err := h.admin.Withdrawals(adminID, userID)
+	if err != nil {
+		logger.Log.Error("error while fetching withdrawals", logger.Int64("admin_id", adminID), logger.Error(err))
+		h.renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	h.render(w, r, http.StatusOK, "user", h.authenticatedPage(r, user.Login, struct {
+		User        *domain.UserSummary
+		Orders      []domain.Order
+		Withdrawals []domain.Withdrawal
+	}{user, orders, withdrawals}))
+}
+
+func (h DashboardHandler) StuckOrders(w http.ResponseWriter, r *http.Request) {
+	orders, err := h.pipeline.StuckOrders(stuckOrdersLimit)
+	if err != nil {
+		logger.Log.Error("error while fetching stuck orders", logger.Error(err))
+		h.renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	h.render(w, r, http.StatusOK, "stuck", h.authenticatedPage(r, "Stuck orders", struct {
+		Age    time.Duration
+		Orders []domain.Order
+	}{h.config.StuckOrderAge, orders}))
+}
+
+func (h DashboardHandler) RequeueOrder(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := h.adminID(w, r)
+	if !ok {
+		return
+	}
+
+	number := chi.URLParam(r, "number")
+	reason := strings.TrimSpace(r.PostForm.Get("reason"))
+	if reason == "" {
+		h.renderError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	err := h.admin.RequeueOrder(adminID, number, reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrOrderNotFound):
+			h.renderError(w, r, http.StatusNotFound)
+		case errors.Is(err, domain.ErrOrderAlreadyProcessed):
+			h.renderError(w, r, http.StatusConflict)
+		default:
+			logger.Log.Error("error while requeueing order", logger.Int64("admin_id", adminID), logger.Error(err))
+			h.renderError(w, r, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	returnTo := r.PostForm.Get("return_to")
+	if !strings.HasPrefix(returnTo, cookiePath+"/") || strings.HasPrefix(returnTo, "//") {
+		returnTo = cookiePath + "/"
+	}
+	http.Redirect(w, r, returnTo+"?requeued="+url.QueryEscape(number), http.StatusSeeOther)
+}
+
+// WithCSRF rejects state-changing requests of authenticated users that don't
+// carry the CSRF token of their session.
+func (h DashboardHandler) WithCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			h.renderError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		expected := h.sessionCSRFToken(r.Header.Get("Session-ID"))
+		if !hmac.Equal([]byte(r.PostForm.Get(csrfFieldName)), []byte(expected)) {
+			logger.Log.Warn("CSRF token mismatch", logger.String("url", r.RequestURI), logger.String("user_id", r.Header.Get("User-ID")))
+			h.renderError(w, r, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startSession stores the token in the cookie, but only for staff: a session
+// of anyone else is revoked right away.
+func (h DashboardHandler) startSession(w http.ResponseWriter, r *http.Request, t string) {
+	claims, err := token.Parse(t, h.config.PrivateKey)
+	if err != nil {
+		logger.Log.Error("error while parsing freshly issued token", logger.Error(err))
+		h.renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	if !slices.Contains(claims.Roles, domain.RoleAdmin) && !slices.Contains(claims.Roles, domain.RoleOperator) {
+		userID, _ := claims.UserID()
+		logger.Log.Warn("dashboard login without staff role", logger.Int64("user_id", userID))
+		if err = h.sessions.Revoke(userID, claims.SessionID); err != nil {
+			logger.Log.Error("error while revoking session", logger.Int64("user_id", userID), logger.Error(err))
+		}
+		h.render(w, r, http.StatusForbidden, "login", page{
+			Title:     "Sign in",
+			CSRFToken: h.preAuthCSRFToken(w, r),
+			Error:     "This account has no access to the admin dashboard.",
+		})
+		return
+	}
+
+	h.setCookie(w, r, middleware.AuthCookieName, t, 0)
+	h.setCookie(w, r, csrfCookieName, "", -1)
+	http.Redirect(w, r, cookiePath+"/", http.StatusSeeOther)
+}
+
+func (h DashboardHandler) authenticatedPage(r *http.Request, title string, data any) page {
+	p := page{
+		Title:         title,
+		Authenticated: true,
+		CSRFToken:     h.sessionCSRFToken(r.Header.Get("Session-ID")),
+		Data:          data,
+	}
+	if number := r.URL.Query().Get("requeued"); number != "" {
+		p.Flash = "Order " + number + " has been re-queued."
+	}
+
+	return p
+}
+
+func (h DashboardHandler) adminID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userIDHeader := r.Header.Get("User-ID")
+	adminID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		h.renderError(w, r, http.StatusInternalServerError)
+		return 0, false
+	}
+
+	return adminID, true
+}
+
+func (h DashboardHandler) sessionCSRFToken(sessionID string) string {
+	mac := hmac.New(sha256.New, []byte(h.config.PrivateKey))
+	mac.Write([]byte("csrf:" + sessionID))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// preAuthCSRFToken returns the value of the pre-login CSRF cookie, setting a
+// new one if there is none yet.
+func (h DashboardHandler) preAuthCSRFToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		logger.Log.Error("error generating CSRF token", logger.Error(err))
+		return ""
+	}
+	value := hex.EncodeToString(b)
+	h.setCookie(w, r, csrfCookieName, value, 0)
+
+	return value
+}
+
+func (h DashboardHandler) checkPreAuthCSRF(w http.ResponseWriter, r *http.Request) bool {
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, r, http.StatusBadRequest)
+		return false
+	}
+
+	cookie, err := r.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" || !hmac.Equal([]byte(cookie.Value), []byte(r.PostForm.Get(csrfFieldName))) {
+		logger.Log.Warn("CSRF token mismatch", logger.String("url", r.RequestURI))
+		h.renderError(w, r, http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+func (h DashboardHandler) setCookie(w http.ResponseWriter, r *http.Request, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     cookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func (h DashboardHandler) renderError(w http.ResponseWriter, r *http.Request, status int) {
+	setSecurityHeaders(w)
+	http.Error(w, http.StatusText(status), status)
+}
+
+func (h DashboardHandler) render(w http.ResponseWriter, r *http.Request, status int, name string, p page) {
+	setSecurityHeaders(w)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+
+	if err := h.pages[name].ExecuteTemplate(w, "layout", p); err != nil {
+		logger.Log.Error("error while rendering dashboard page", logger.String("page", name), logger.Error(err))
+	}
+}
+
+func setSecurityHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "same-origin")
+	w.Header().Set("Cache-Control", "no-store")
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+	"net/http"
+	"strconv"
+)
+
+type accountStatuses interface {
+	Status(userID int64) (string, error)
+}
+
+// WithActiveAccount rejects requests of users whose account isn't active, e.g.
+// suspended ones. It guards the routes that move money or orders, so it reads
+// the status afresh rather than trusting the User-Status header WithAuth sets
+// from its cache, which may lag behind a change made on another replica.
+func WithActiveAccount(statuses accountStatuses) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := strconv.ParseInt(r.Header.Get("User-ID"), 10, 64)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			status, err := statuses.Status(userID)
+			if errors.Is(err, domain.ErrUserNotFound) {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				logger.Log.Error("error while fetching account status", logger.Int64("user_id", userID), logger.Error(err))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			if status != domain.UserStatusActive {
+				logger.Log.Warn(
+					"request of an inactive account",
+					logger.String("url", r.RequestURI),
+					logger.Int64("user_id", userID),
+				)
+				http.Error(w, "account suspended", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
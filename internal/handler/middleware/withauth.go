@@ -1,18 +1,35 @@
 package middleware
 
 import (
-	"github.com/dgrijalva/jwt-go"
+	"errors"
 	"github.com/koyif/gophermart/internal/config"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/token"
 	"github.com/koyif/gophermart/pkg/logger"
 	"net/http"
 	"strings"
 )
 
-func WithAuth(cfg *config.Config) func(http.Handler) http.Handler {
+// AuthCookieName is the cookie the admin dashboard keeps its token in.
+const AuthCookieName = "gophermart_token"
+
+type sessionValidator interface {
+	Validate(sessionID string, userID int64) (string, error)
+}
+
+// identityHeaders carry the identity WithAuth and WithCookieAuth pass on to
+// the handlers. Whatever the client sent in them is dropped.
+var identityHeaders = []string{"User-ID", "Session-ID", "User-Roles", "User-Status"}
+
+// WithAuth authenticates requests by their bearer token, except for the paths
+// of AuthDisabledURLs, which must match the request path exactly.
+func WithAuth(cfg *config.Config, sessions sessionValidator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clearIdentity(r)
+
 			for _, ignore := range cfg.AuthDisabledURLs {
-				if strings.HasSuffix(r.RequestURI, ignore) {
+				if r.URL.Path == ignore {
 					next.ServeHTTP(w, r)
 					return
 				}
@@ -25,20 +42,85 @@ func WithAuth(cfg *config.Config) func(http.Handler) http.Handler {
 				return
 			}
 
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			var claims jwt.StandardClaims
-			_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
-				return []byte(cfg.PrivateKey), nil
-			})
+			status := authenticate(cfg, sessions, r, strings.TrimPrefix(authHeader, "Bearer "))
+			if status != http.StatusOK {
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WithCookieAuth authenticates browser requests by the token stored in the
+// AuthCookieName cookie and redirects to loginURL if there is no valid one.
+func WithCookieAuth(cfg *config.Config, sessions sessionValidator, loginURL string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clearIdentity(r)
+
+			cookie, err := r.Cookie(AuthCookieName)
 			if err != nil {
-				logger.Log.Warn("unauthorized request", logger.String("url", r.RequestURI), logger.Error(err))
-				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				http.Redirect(w, r, loginURL, http.StatusSeeOther)
 				return
 			}
 
-			r.Header.Set("User-ID", claims.Subject)
+			status := authenticate(cfg, sessions, r, cookie.Value)
+			if status == http.StatusUnauthorized {
+				http.Redirect(w, r, loginURL, http.StatusSeeOther)
+				return
+			}
+			if status != http.StatusOK {
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+func clearIdentity(r *http.Request) {
+	for _, header := range identityHeaders {
+		r.Header.Del(header)
+	}
+}
+
+// authenticate checks the token and its session and passes the identity on to
+// the handlers in the identityHeaders. It returns the HTTP status to respond
+// with, http.StatusOK on success.
+func authenticate(cfg *config.Config, sessions sessionValidator, r *http.Request, tokenString string) int {
+	claims, err := token.Parse(tokenString, cfg.PrivateKey)
+	if err != nil {
+		logger.Log.Warn("unauthorized request", logger.String("url", r.RequestURI), logger.Error(err))
+		return http.StatusUnauthorized
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		logger.Log.Warn("unauthorized request", logger.String("url", r.RequestURI), logger.Error(err))
+		return http.StatusUnauthorized
+	}
+
+	status, err := sessions.Validate(claims.SessionID, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionRevoked) {
+			logger.Log.Warn("revoked session", logger.Int64("user_id", userID))
+			return http.StatusUnauthorized
+		}
+		if errors.Is(err, domain.ErrAccountClosed) {
+			logger.Log.Warn("request of a closed account", logger.Int64("user_id", userID))
+			return http.StatusForbidden
+		}
+		logger.Log.Error("error while validating session", logger.Int64("user_id", userID), logger.Error(err))
+		return http.StatusInternalServerError
+	}
+
+	r.Header.Set("User-ID", claims.Subject)
+	r.Header.Set("Session-ID", claims.SessionID)
+	r.Header.Set("User-Roles", strings.Join(claims.Roles, ","))
+	r.Header.Set("User-Status", status)
+
+	return http.StatusOK
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 8 << 20
+)
+
+// idempotentHeaders change the outcome of the requests guarded by
+// WithIdempotency: Content-Type switches order uploads between text and JSON,
+// X-TOTP-Code decides whether a withdrawal goes through.
+var idempotentHeaders = []string{"Content-Type", "X-TOTP-Code"}
+
+type idempotencyService interface {
+	Begin(userID int64, key, method, path string, headers []string, body []byte) (*domain.IdempotentResponse, error)
+	Complete(userID int64, key string, response domain.IdempotentResponse) error
+	Release(userID int64, key string) error
+}
+
+// recordingWriter passes the response through while keeping a copy of its
+// status and body.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// WithIdempotency makes a request carrying an Idempotency-Key safe to retry:
+// the first response is stored per user and key, and a replay of the request
+// gets it back with the Idempotent-Replayed header set instead of being
+// executed again. Reusing the key for a different request, including one with
+// other idempotentHeaders, is rejected with 422, retrying while the first
+// request is still running with 409. Server
+// errors aren't stored, so the request can be retried with the same key.
+// It relies on the User-ID header set by WithAuth.
+func WithIdempotency(idempotency idempotencyService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				http.Error(w, "idempotency key is too long", http.StatusBadRequest)
+				return
+			}
+
+			userID, err := strconv.ParseInt(r.Header.Get("User-ID"), 10, 64)
+			if err != nil {
+				logger.Log.Warn("error parsing user ID", logger.String("url", r.RequestURI), logger.Error(err))
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentRequestBytes))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			headers := make([]string, len(idempotentHeaders))
+			for i, header := range idempotentHeaders {
+				headers[i] = r.Header.Get(header)
+			}
+
+			stored, err := idempotency.Begin(userID, key, r.Method, r.URL.Path, headers, body)
+			if err != nil {
+				if errors.Is(err, domain.ErrIdempotencyKeyReused) {
+					http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+					return
+				}
+				if errors.Is(err, domain.ErrIdempotencyKeyInProgress) {
+					http.Error(w, err.Error(), http.StatusConflict)
+					return
+				}
+				logger.Log.Error("error while claiming idempotency key", logger.Int64("user_id", userID), logger.Error(err))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			if stored != nil {
+				if stored.ContentType != "" {
+					w.Header().Set("Content-Type", stored.ContentType)
+				}
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(stored.StatusCode)
+				if _, err := w.Write(stored.Body); err != nil {
+					logger.Log.Warn("error writing replayed response", logger.Error(err))
+				}
+				return
+			}
+
+			rw := &recordingWriter{ResponseWriter: w}
+			defer func() {
+				if rw.status == 0 || rw.status >= http.StatusInternalServerError {
+					if err := idempotency.Release(userID, key); err != nil {
+						logger.Log.Error("error while releasing idempotency key", logger.Int64("user_id", userID), logger.Error(err))
+					}
+					return
+				}
+
+				err := idempotency.Complete(userID, key, domain.IdempotentResponse{
+					StatusCode:  rw.status,
+					ContentType: rw.Header().Get("Content-Type"),
+					Body:        rw.body.Bytes(),
+				})
+				if err != nil {
+					logger.Log.Error("error while storing idempotent response", logger.Int64("user_id", userID), logger.Error(err))
+				}
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
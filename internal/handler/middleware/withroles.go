@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"github.com/koyif/gophermart/pkg/logger"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+type userRoles interface {
+	Roles(userID int64) ([]string, error)
+}
+
+// WithRoles lets the request through only if the authenticated user has at
+// least one of the allowed roles. The roles in the token stay as they were at
+// login, so they are read afresh, a user demoted since loses access at once.
+func WithRoles(roles userRoles, allowed ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := strconv.ParseInt(r.Header.Get("User-ID"), 10, 64)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			current, err := roles.Roles(userID)
+			if err != nil {
+				logger.Log.Error("error while fetching roles", logger.Int64("user_id", userID), logger.Error(err))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			for _, role := range current {
+				if slices.Contains(allowed, role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			logger.Log.Warn(
+				"forbidden request",
+				logger.String("url", r.RequestURI),
+				logger.Int64("user_id", userID),
+			)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}
+}
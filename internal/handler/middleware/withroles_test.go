@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/koyif/gophermart/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeRoles map[int64][]string
+
+func (f fakeRoles) Roles(userID int64) ([]string, error) {
+	if userID == 0 {
+		return nil, errors.New("database is down")
+	}
+	return f[userID], nil
+}
+
+func TestWithRoles(t *testing.T) {
+	roles := fakeRoles{
+		1: {domain.RoleAdmin},
+		2: {domain.RoleOperator},
+		3: nil,
+	}
+	handler := WithRoles(roles, domain.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name       string
+		userID     string
+		tokenRoles string
+		want       int
+	}{
+		{name: "admin", userID: "1", want: http.StatusNoContent},
+		{name: "operator", userID: "2", want: http.StatusForbidden},
+		{name: "demoted since login", userID: "3", tokenRoles: domain.RoleAdmin, want: http.StatusForbidden},
+		{name: "not authenticated", want: http.StatusUnauthorized},
+		{name: "roles unavailable", userID: "0", want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/admin/users/1/adjustments", nil)
+			r.Header.Set("User-ID", tt.userID)
+			r.Header.Set("User-Roles", tt.tokenRoles)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/koyif/gophermart/pkg/logger"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	SignatureHeader          = "X-Signature"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	maxSignedRequestBytes    = 1 << 20
+)
+
+// WithSignature authenticates requests of other services by an HMAC-SHA256,
+// hex encoded in the X-Signature header, over the Unix timestamp from the
+// X-Signature-Timestamp header, a dot and the body. Requests whose timestamp
+// is more than maxSkew away from now are rejected, which limits replays.
+func WithSignature(secret string, maxSkew time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timestamp := r.Header.Get(SignatureTimestampHeader)
+			unix, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				logger.Log.Warn("signed request without a valid timestamp", logger.String("url", r.RequestURI))
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			if skew := time.Since(time.Unix(unix, 0)); skew > maxSkew || skew < -maxSkew {
+				logger.Log.Warn("signed request out of the time window", logger.String("url", r.RequestURI), logger.String("timestamp", timestamp))
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			signature, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+			if err != nil || len(signature) == 0 {
+				logger.Log.Warn("signed request without a valid signature", logger.String("url", r.RequestURI))
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedRequestBytes))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(timestamp))
+			mac.Write([]byte("."))
+			mac.Write(body)
+			if !hmac.Equal(signature, mac.Sum(nil)) {
+				logger.Log.Warn("signed request with a wrong signature", logger.String("url", r.RequestURI))
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
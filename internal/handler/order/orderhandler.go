@@ -1,30 +1,50 @@
 package orderhandler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"github.com/go-chi/chi/v5"
 	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/handler/pagination"
+	"github.com/koyif/gophermart/internal/ordernumber"
 	"github.com/koyif/gophermart/pkg/dto"
 	"github.com/koyif/gophermart/pkg/logger"
-	"github.com/theplant/luhn"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
+var orderStatuses = []string{"NEW", "PROCESSING", "INVALID", "PROCESSED", "CANCELLED"}
+
 type OrderService interface {
-	Create(orderID string, userID int64) error
-	Orders(userID int64) ([]domain.Order, error)
+	Create(orderID string, userID int64, metadata domain.OrderMetadata) error
+	Orders(userID int64, query domain.ListQuery) ([]domain.Order, *domain.Cursor, error)
+	Order(userID int64, number string) (*domain.OrderDetails, error)
+	CreateBatch(numbers []string, userID int64) ([]domain.OrderUpload, error)
+	Cancel(userID int64, number string) error
+}
+
+// numberValidator picks the order number scheme by the store of the order
+// metadata and the number itself.
+type numberValidator interface {
+	Validate(storeID, number string) error
 }
 
 type OrderHandler struct {
-	srv OrderService
+	srv          OrderService
+	numbers      numberValidator
+	maxBatchSize int
 }
 
-func New(srv OrderService) *OrderHandler {
+func New(srv OrderService, numbers numberValidator, maxBatchSize int) *OrderHandler {
 	return &OrderHandler{
-		srv: srv,
+		srv:          srv,
+		numbers:      numbers,
+		maxBatchSize: maxBatchSize,
 	}
 }
 
@@ -50,16 +70,21 @@ func (h OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orderNumber, err := strconv.ParseInt(string(body), 10, 64)
+	orderNumber, metadata, err := parseOrder(r, body)
 	if err != nil {
-		logger.Log.Warn("invalid order ID", logger.Error(err))
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		logger.Log.Warn("malformed order upload", logger.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if ok := luhn.Valid(int(orderNumber)); !ok {
-		logger.Log.Warn("invalid order ID, Luhn check failed", logger.Int64("orderNumber", orderNumber))
-		http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
+	if err = h.numbers.Validate(metadata.StoreID, orderNumber); err != nil {
+		if errors.Is(err, ordernumber.ErrInvalidNumber) {
+			logger.Log.Warn("invalid order number", logger.String("number", orderNumber))
+			http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
+			return
+		}
+		logger.Log.Warn("malformed order number", logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
@@ -71,19 +96,19 @@ func (h OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.srv.Create(strconv.FormatInt(orderNumber, 10), userID)
+	err = h.srv.Create(orderNumber, userID, metadata)
 	if err != nil {
 		if errors.Is(err, domain.ErrOrderExists) {
-			logger.Log.Warn("order already exists", logger.Int64("order_id", orderNumber))
+			logger.Log.Warn("order already exists", logger.String("number", orderNumber))
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 		if errors.Is(err, domain.ErrOrderAddedByAnotherUser) {
-			logger.Log.Warn("order belongs to another user", logger.Int64("order_id", orderNumber))
+			logger.Log.Warn("order belongs to another user", logger.String("number", orderNumber))
 			http.Error(w, "order belongs to another user", http.StatusConflict)
 			return
 		}
-		logger.Log.Error("error while creating order", logger.Int64("order_id", orderNumber), logger.Error(err))
+		logger.Log.Error("error while creating order", logger.String("number", orderNumber), logger.Error(err))
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -91,6 +116,130 @@ func (h OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// parseOrder reads an order upload, either the bare number as text/plain or a
+// dto.NewOrder carrying the metadata of the purchase as application/json. An
+// order with goods is registered with the accrual system by gophermart.
+func parseOrder(r *http.Request, body []byte) (string, domain.OrderMetadata, error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return strings.TrimSpace(string(body)), domain.OrderMetadata{}, nil
+	}
+
+	var req dto.NewOrder
+	if err := json.Unmarshal(body, &req); err != nil {
+		return "", domain.OrderMetadata{}, errors.New("malformed JSON")
+	}
+	if err := req.IsValid(); err != nil {
+		return "", domain.OrderMetadata{}, err
+	}
+
+	metadata := domain.OrderMetadata{
+		StoreID:        req.StoreID,
+		PurchaseAmount: req.PurchaseAmount,
+		Currency:       req.Currency,
+	}
+	for _, good := range req.Goods {
+		metadata.Goods = append(metadata.Goods, domain.OrderGood(good))
+	}
+	if req.PurchasedAt != nil {
+		purchasedAt := req.PurchasedAt.UTC()
+		metadata.PurchasedAt = &purchasedAt
+	}
+
+	return strings.TrimSpace(req.Number), metadata, nil
+}
+
+// CreateBatch uploads many orders at once. The body is either a JSON array of
+// numbers or text/plain with one number per line. Every number gets its own
+// result, invalid ones don't fail the batch.
+func (h OrderHandler) CreateBatch(w http.ResponseWriter, r *http.Request) {
+	userIDHeader := r.Header.Get("User-ID")
+	userID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	numbers, status := h.readBatch(w, r)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	// Batches carry no metadata, their numbers are validated by prefix.
+	uploads := make([]dto.OrderUpload, len(numbers))
+	var valid []string
+	for i, number := range numbers {
+		if h.numbers.Validate("", number) != nil {
+			uploads[i] = dto.OrderUpload{Number: number, Result: domain.OrderUploadInvalidNumber}
+			continue
+		}
+		valid = append(valid, number)
+	}
+
+	if len(valid) > 0 {
+		results, err := h.srv.CreateBatch(valid, userID)
+		if err != nil {
+			logger.Log.Error("error while creating orders", logger.Int64("user_id", userID), logger.Error(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		next := 0
+		for i := range uploads {
+			if uploads[i].Result == "" {
+				uploads[i] = dto.OrderUpload{Number: results[next].Number, Result: results[next].Result}
+				next++
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(uploads); err != nil {
+		logger.Log.Error("error while encoding order uploads to JSON", logger.Int64("user_id", userID), logger.Error(err))
+	}
+}
+
+// readBatch returns the numbers of a batch upload, or the status to respond
+// with if the body is malformed, empty or too big.
+func (h OrderHandler) readBatch(w http.ResponseWriter, r *http.Request) ([]string, int) {
+	// No valid batch comes close to 64 bytes per number.
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(h.maxBatchSize)*64+1024))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, http.StatusRequestEntityTooLarge
+		}
+		logger.Log.Warn("error while reading request body")
+		return nil, http.StatusBadRequest
+	}
+
+	var numbers []string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err = json.Unmarshal(body, &numbers); err != nil {
+			logger.Log.Warn("error while decoding order batch", logger.Error(err))
+			return nil, http.StatusBadRequest
+		}
+	} else {
+		for _, line := range strings.Split(string(body), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				numbers = append(numbers, line)
+			}
+		}
+	}
+
+	if len(numbers) == 0 {
+		return nil, http.StatusBadRequest
+	}
+	if len(numbers) > h.maxBatchSize {
+		logger.Log.Warn("order batch too large", logger.Int64("size", int64(len(numbers))))
+		return nil, http.StatusRequestEntityTooLarge
+	}
+
+	return numbers, http.StatusOK
+}
+
 func (h OrderHandler) Orders(w http.ResponseWriter, r *http.Request) {
 	userIDHeader := r.Header.Get("User-ID")
 	userID, err := strconv.ParseInt(userIDHeader, 10, 64)
@@ -100,13 +249,21 @@ func (h OrderHandler) Orders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orders, err := h.srv.Orders(userID)
+	query, err := pagination.ParseQuery(r, orderStatuses...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orders, next, err := h.srv.Orders(userID, query)
 	if err != nil {
 		logger.Log.Error("error while fetching orders", logger.Int64("user_id", userID), logger.Error(err))
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
+	pagination.SetNext(w, r, next)
+
 	if len(orders) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return
@@ -114,12 +271,7 @@ func (h OrderHandler) Orders(w http.ResponseWriter, r *http.Request) {
 
 	dtos := make([]dto.Order, len(orders))
 	for i, order := range orders {
-		dtos[i] = dto.Order{
-			Number:     order.Number,
-			Status:     order.Status,
-			Accrual:    order.Accrual,
-			UploadedAt: order.UploadedAt.Format(time.RFC3339),
-		}
+		dtos[i] = toOrder(order)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -131,3 +283,146 @@ func (h OrderHandler) Orders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// Order returns the details of one order. The response carries an ETag, so
+// clients polling an order get 304 Not Modified until something changes.
+func (h OrderHandler) Order(w http.ResponseWriter, r *http.Request) {
+	userIDHeader := r.Header.Get("User-ID")
+	userID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	order, err := h.srv.Order(userID, chi.URLParam(r, "number"))
+	if err != nil {
+		if errors.Is(err, domain.ErrOrderNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		logger.Log.Error("error while fetching order", logger.Int64("user_id", userID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.OrderDetails{
+		Order:      toOrder(order.Order),
+		CheckCount: order.CheckCount,
+		Goods:      toGoods(order.Metadata.Goods),
+		History:    make([]dto.OrderStatusChange, len(order.History)),
+	}
+	if order.LastCheckedAt != nil {
+		lastCheckedAt := order.LastCheckedAt.Format(time.RFC3339)
+		resp.LastCheckedAt = &lastCheckedAt
+	}
+	for i, change := range order.History {
+		resp.History[i] = dto.OrderStatusChange{
+			Status:    change.Status,
+			Accrual:   change.Accrual,
+			ChangedAt: change.ChangedAt.Format(time.RFC3339),
+		}
+		if change.AccrualResponse != "" {
+			resp.History[i].AccrualResponse = json.RawMessage(change.AccrualResponse)
+		}
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		logger.Log.Error("error while encoding order to JSON", logger.Int64("user_id", userID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(body); err != nil {
+		logger.Log.Error("error while writing order", logger.Int64("user_id", userID), logger.Error(err))
+	}
+}
+
+// Cancel withdraws an order upload that the accrual system hasn't processed
+// yet, so that the number can be uploaded again, e.g. by its real owner.
+func (h OrderHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	userIDHeader := r.Header.Get("User-ID")
+	userID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	number := chi.URLParam(r, "number")
+	err = h.srv.Cancel(userID, number)
+	if err != nil {
+		if errors.Is(err, domain.ErrOrderNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, domain.ErrOrderNotCancellable) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		logger.Log.Error("error while cancelling order", logger.Int64("user_id", userID), logger.String("number", number), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Log.Info("order cancelled", logger.Int64("user_id", userID), logger.String("number", number))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// etagMatches implements the weak comparison of If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func toOrder(order domain.Order) dto.Order {
+	resp := dto.Order{
+		Number:             order.Number,
+		Status:             order.Status,
+		Accrual:            order.Accrual,
+		UploadedAt:         order.UploadedAt.Format(time.RFC3339),
+		StoreID:            order.Metadata.StoreID,
+		PurchaseAmount:     order.Metadata.PurchaseAmount,
+		Currency:           order.Metadata.Currency,
+		RegistrationStatus: order.RegistrationStatus,
+	}
+	if order.Metadata.PurchasedAt != nil {
+		resp.PurchasedAt = order.Metadata.PurchasedAt.Format(time.RFC3339)
+	}
+
+	return resp
+}
+
+func toGoods(goods []domain.OrderGood) []dto.OrderGood {
+	if len(goods) == 0 {
+		return nil
+	}
+
+	dtos := make([]dto.OrderGood, len(goods))
+	for i, good := range goods {
+		dtos[i] = dto.OrderGood(good)
+	}
+
+	return dtos
+}
@@ -0,0 +1,136 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+
+	// NextCursorHeader carries the cursor of the next page in addition to the
+	// Link header, for clients that don't parse the latter.
+	NextCursorHeader = "X-Next-Cursor"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// ParseQuery reads limit, cursor, sort (asc or desc, newest first by default),
+// status and an RFC 3339 from/to range from the query string. A status filter
+// is accepted only if statuses lists the allowed values. Clients that ask for
+// neither a limit nor a cursor get the full list, as before pagination was
+// introduced, a cursor alone pages by DefaultLimit.
+func ParseQuery(r *http.Request, statuses ...string) (domain.ListQuery, error) {
+	values := r.URL.Query()
+	query := domain.ListQuery{
+		Sort: domain.SortDesc,
+	}
+	if values.Get("cursor") != "" {
+		query.Limit = DefaultLimit
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > MaxLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+		}
+		query.Limit = n
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		if sort != domain.SortAsc && sort != domain.SortDesc {
+			return query, errors.New("sort must be asc or desc")
+		}
+		query.Sort = sort
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		after, err := DecodeCursor(cursor)
+		if err != nil {
+			return query, err
+		}
+		query.After = after
+	}
+
+	if status := values.Get("status"); status != "" {
+		if !slices.Contains(statuses, status) {
+			return query, errors.New("unsupported status filter")
+		}
+		query.Status = status
+	}
+
+	var err error
+	if query.From, err = parseTime(values.Get("from")); err != nil {
+		return query, errors.New("from must be an RFC 3339 date")
+	}
+	if query.To, err = parseTime(values.Get("to")); err != nil {
+		return query, errors.New("to must be an RFC 3339 date")
+	}
+
+	return query, nil
+}
+
+// SetNext advertises the next page, if there is one, in the Link and
+// X-Next-Cursor headers. It must be called before the header is written.
+func SetNext(w http.ResponseWriter, r *http.Request, next *domain.Cursor) {
+	if next == nil {
+		return
+	}
+
+	cursor := EncodeCursor(*next)
+	values := r.URL.Query()
+	values.Set("cursor", cursor)
+
+	w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, values.Encode()))
+	w.Header().Set(NextCursorHeader, cursor)
+}
+
+func EncodeCursor(cursor domain.Cursor) string {
+	raw := strconv.FormatInt(cursor.At.UnixMicro(), 10) + ":" + strconv.FormatInt(cursor.ID, 10)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(cursor string) (*domain.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	at, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+
+	micros, err := strconv.ParseInt(at, 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	itemID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &domain.Cursor{At: time.UnixMicro(micros).UTC(), ID: itemID}, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t.UTC(), nil
+}
@@ -0,0 +1,90 @@
+package sessionhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/dto"
+	"github.com/koyif/gophermart/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type sessionService interface {
+	Sessions(userID int64) ([]domain.Session, error)
+	Revoke(userID int64, sessionID string) error
+}
+
+type SessionHandler struct {
+	srv sessionService
+}
+
+func New(srv sessionService) *SessionHandler {
+	return &SessionHandler{
+		srv: srv,
+	}
+}
+
+func (h SessionHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	userIDHeader := r.Header.Get("User-ID")
+	userID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := h.srv.Sessions(userID)
+	if err != nil {
+		logger.Log.Error("error while fetching sessions", logger.Int64("user_id", userID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	currentSessionID := r.Header.Get("Session-ID")
+	dtos := make([]dto.Session, len(sessions))
+	for i, session := range sessions {
+		dtos[i] = dto.Session{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt.Format(time.RFC3339),
+			LastSeenAt: session.LastSeenAt.Format(time.RFC3339),
+			Current:    session.ID == currentSessionID,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dtos)
+	if err != nil {
+		logger.Log.Error("error while encoding sessions to JSON", logger.Int64("user_id", userID), logger.Error(err))
+		return
+	}
+}
+
+func (h SessionHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	userIDHeader := r.Header.Get("User-ID")
+	userID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	err = h.srv.Revoke(userID, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		logger.Log.Error("error while revoking session", logger.Int64("user_id", userID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,174 @@
+package twofactorhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/dto"
+	"github.com/koyif/gophermart/pkg/logger"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+type twoFactorService interface {
+	Enroll(userID int64) (*domain.TOTPEnrollment, error)
+	Confirm(userID int64, code string) ([]string, error)
+	Disable(userID int64, code string) error
+}
+
+type TwoFactorHandler struct {
+	srv twoFactorService
+}
+
+func New(srv twoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		srv: srv,
+	}
+}
+
+func (h TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	userIDHeader := r.Header.Get("User-ID")
+	userID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	enrollment, err := h.srv.Enroll(userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrTwoFactorAlreadyEnabled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		logger.Log.Error("error while enrolling TOTP", logger.Int64("user_id", userID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.TOTPEnrollment{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		logger.Log.Error("error while encoding TOTP enrollment to JSON", logger.Int64("user_id", userID), logger.Error(err))
+		return
+	}
+}
+
+func (h TwoFactorHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	userIDHeader := r.Header.Get("User-ID")
+	userID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	req, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.srv.Confirm(userID, req.Code)
+	if err != nil {
+		if errors.Is(err, domain.ErrTwoFactorAlreadyEnabled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, domain.ErrTwoFactorNotEnrolled) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidTwoFactorCode) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if errors.Is(err, domain.ErrTwoFactorLocked) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		logger.Log.Error("error while confirming TOTP", logger.Int64("user_id", userID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dto.RecoveryCodes{RecoveryCodes: codes})
+	if err != nil {
+		logger.Log.Error("error while encoding recovery codes to JSON", logger.Int64("user_id", userID), logger.Error(err))
+		return
+	}
+}
+
+func (h TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	userIDHeader := r.Header.Get("User-ID")
+	userID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	req, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.srv.Disable(userID, req.Code)
+	if err != nil {
+		if errors.Is(err, domain.ErrTwoFactorNotEnrolled) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidTwoFactorCode) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, domain.ErrTwoFactorLocked) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		logger.Log.Error("error while disabling TOTP", logger.Int64("user_id", userID), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeCode(w http.ResponseWriter, r *http.Request) (*dto.TwoFactorCode, bool) {
+	var req dto.TwoFactorCode
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Log.Warn("error while decoding a two-factor code request")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return nil, false
+	}
+	defer func(body io.ReadCloser) {
+		err := body.Close()
+		if err != nil {
+			logger.Log.Error("error while closing request body", logger.Error(err))
+			return
+		}
+	}(r.Body)
+
+	if err := req.IsValid(); err != nil {
+		logger.Log.Warn("invalid two-factor code fields", logger.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &req, true
+}
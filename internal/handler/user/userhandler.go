@@ -4,15 +4,20 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/handler/client"
 	"github.com/koyif/gophermart/pkg/dto"
 	"github.com/koyif/gophermart/pkg/logger"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type UserService interface {
-	Register(username, password string) (string, error)
-	Login(login, password string) (string, error)
+	Register(username, password string, client domain.ClientInfo) (string, error)
+	Login(login, password string, client domain.ClientInfo) (*domain.LoginResult, error)
+	CompleteLogin(challengeID, code string, client domain.ClientInfo) (string, error)
+	ChangePassword(userID int64, currentPassword, newPassword string, client domain.ClientInfo) (string, error)
 }
 
 type UserHandler struct {
@@ -43,18 +48,22 @@ func (uh *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		}
 	}(r.Body)
 
-	if err := auth.IsValid(); err != nil {
+	if err := auth.IsValidRegistration(); err != nil {
 		logger.Log.Warn("invalid auth fields", logger.Error(err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	token, err := uh.srv.Register(auth.Login, auth.Password)
+	token, err := uh.srv.Register(auth.Login, auth.Password, client.Info(r))
 	if err != nil {
 		if errors.Is(err, domain.ErrUserExists) {
 			http.Error(w, "user already exists", http.StatusConflict)
 			return
 		}
+		if errors.Is(err, domain.ErrPasswordTooLong) || errors.Is(err, domain.ErrWeakPassword) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
@@ -87,13 +96,126 @@ func (uh *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := uh.srv.Login(auth.Login, auth.Password)
+	result, err := uh.srv.Login(auth.Login, auth.Password, client.Info(r))
 	if err != nil {
 		if errors.Is(err, domain.ErrIncorrectCredentials) {
 			http.Error(w, "incorrect login or password", http.StatusUnauthorized)
 			return
 		}
+		if errors.Is(err, domain.ErrAccountClosed) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, domain.ErrTwoFactorLocked) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if result.Challenge != nil {
+		resp := dto.TwoFactorChallenge{
+			Challenge: result.Challenge.ID,
+			ExpiresAt: result.Challenge.ExpiresAt.Format(time.RFC3339),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		if err = json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Log.Error("error while encoding two-factor challenge to JSON", logger.Error(err))
+		}
+		return
+	}
+
+	w.Header().Set("Authorization", "Bearer "+result.Token)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (uh *UserHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req dto.TwoFactorLogin
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Log.Warn("error while decoding a two-factor login request")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	defer func(body io.ReadCloser) {
+		err := body.Close()
+		if err != nil {
+			logger.Log.Error("error while closing request body", logger.Error(err))
+			return
+		}
+	}(r.Body)
+
+	if err := req.IsValid(); err != nil {
+		logger.Log.Warn("invalid two-factor login fields", logger.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := uh.srv.CompleteLogin(req.Challenge, req.Code, client.Info(r))
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidChallenge) || errors.Is(err, domain.ErrInvalidTwoFactorCode) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, domain.ErrTwoFactorLocked) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		logger.Log.Error("error while completing two-factor login", logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Authorization", "Bearer "+token)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (uh *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userIDHeader := r.Header.Get("User-ID")
+	userID, err := strconv.ParseInt(userIDHeader, 10, 64)
+	if err != nil {
+		logger.Log.Error("error while parsing user ID from header", logger.String("user_id", userIDHeader), logger.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	var req dto.PasswordChange
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Log.Warn("error while decoding a password change request")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	defer func(body io.ReadCloser) {
+		err := body.Close()
+		if err != nil {
+			logger.Log.Error("error while closing request body", logger.Error(err))
+			return
+		}
+	}(r.Body)
+
+	if err := req.IsValid(); err != nil {
+		logger.Log.Warn("invalid password change fields", logger.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := uh.srv.ChangePassword(userID, req.CurrentPassword, req.NewPassword, client.Info(r))
+	if err != nil {
+		if errors.Is(err, domain.ErrIncorrectCredentials) {
+			http.Error(w, "incorrect current password", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, domain.ErrPasswordTooLong) || errors.Is(err, domain.ErrWeakPassword) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
+		logger.Log.Error("error while changing password", logger.Int64("user_id", userID), logger.Error(err))
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,35 @@
+package ordernumber
+
+type luhnValidator struct{}
+
+func (luhnValidator) Validate(number string) error {
+	if err := checkDigits(number); err != nil {
+		return err
+	}
+
+	if !Luhn(number) {
+		return ErrInvalidNumber
+	}
+
+	return nil
+}
+
+// Luhn reports whether a string of digits has a valid Luhn check digit. It
+// doesn't check that the string consists of digits.
+func Luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
@@ -0,0 +1,114 @@
+package ordernumber
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// luhnCheckDigit computes the check digit to append to digits, independently
+// of Luhn.
+func luhnCheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 0 {
+			d = d*2/10 + d*2%10
+		}
+		sum += d
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+func onlyDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func FuzzLuhnValidator(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"0",
+		"79927398713",
+		"0079927398713",
+		"12345678903",
+		"4561261212345467",
+		"18446744073709551617",
+		"000000000000000000000000000000000000000000000000000000000000000",
+		strings.Repeat("9", MaxLength+1),
+		"7992739871x",
+		"1234-5678",
+		" 79927398713",
+		"٣",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, number string) {
+		err := luhnValidator{}.Validate(number)
+
+		switch {
+		case len(number) == 0 || len(number) > MaxLength:
+			if !errors.Is(err, ErrInvalidFormat) {
+				t.Fatalf("Validate(%q) = %v, want ErrInvalidFormat for length %d", number, err, len(number))
+			}
+		case !onlyDigits(number):
+			if !errors.Is(err, ErrInvalidFormat) {
+				t.Fatalf("Validate(%q) = %v, want ErrInvalidFormat for non-digits", number, err)
+			}
+		case luhnCheckDigit(number[:len(number)-1]) == number[len(number)-1]:
+			if err != nil {
+				t.Fatalf("Validate(%q) = %v, want nil", number, err)
+			}
+		default:
+			if !errors.Is(err, ErrInvalidNumber) {
+				t.Fatalf("Validate(%q) = %v, want ErrInvalidNumber", number, err)
+			}
+		}
+
+		// Leading zeros don't change the check digit, so a number is valid
+		// with them exactly when it is valid without them.
+		if len(number) < MaxLength && onlyDigits(number) && number != "" {
+			padded := "0" + number
+			if paddedErr := (luhnValidator{}).Validate(padded); (paddedErr == nil) != (err == nil) {
+				t.Fatalf("Validate(%q) = %v, but Validate(%q) = %v", padded, paddedErr, number, err)
+			}
+		}
+	})
+}
+
+func FuzzLuhnCheckDigit(f *testing.F) {
+	for _, seed := range []string{
+		"7992739871",
+		"0000",
+		"1844674407370955161",
+		"18446744073709551616123",
+		strings.Repeat("1", MaxLength-1),
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, prefix string) {
+		if len(prefix) >= MaxLength || !onlyDigits(prefix) {
+			t.Skip()
+		}
+
+		number := prefix + string(luhnCheckDigit(prefix))
+		if err := (luhnValidator{}).Validate(number); err != nil {
+			t.Fatalf("Validate(%q) = %v, want nil", number, err)
+		}
+
+		// Any other check digit is rejected.
+		last := number[len(number)-1]
+		wrong := number[:len(number)-1] + string('0'+(last-'0'+1)%10)
+		if err := (luhnValidator{}).Validate(wrong); !errors.Is(err, ErrInvalidNumber) {
+			t.Fatalf("Validate(%q) = %v, want ErrInvalidNumber", wrong, err)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+// Package ordernumber validates order numbers. Numbers are handled as strings,
+// so that numbers of any length are supported and leading zeros are kept.
+// Which scheme applies to a number is decided by a Registry.
+package ordernumber
+
+import "errors"
+
+// MaxLength is the size of the order number columns.
+const MaxLength = 64
+
+var (
+	ErrInvalidFormat = errors.New("order number must be 1 to 64 letters, digits, dashes or underscores")
+	ErrInvalidNumber = errors.New("order number is not valid for its scheme")
+)
+
+// Validator checks order numbers of one scheme. It returns ErrInvalidFormat
+// for strings that can't be an order number at all and ErrInvalidNumber for
+// numbers rejected by the scheme, e.g. because of a wrong check digit.
+type Validator interface {
+	Validate(number string) error
+}
+
+// checkFormat accepts the characters that any scheme may use in a number.
+func checkFormat(number string) error {
+	if len(number) == 0 || len(number) > MaxLength {
+		return ErrInvalidFormat
+	}
+
+	for i := 0; i < len(number); i++ {
+		c := number[i]
+		if !isDigit(c) && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && c != '-' && c != '_' {
+			return ErrInvalidFormat
+		}
+	}
+
+	return nil
+}
+
+// checkDigits accepts strings of digits only.
+func checkDigits(number string) error {
+	if err := checkFormat(number); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(number); i++ {
+		if !isDigit(number[i]) {
+			return ErrInvalidFormat
+		}
+	}
+
+	return nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
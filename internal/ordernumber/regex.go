@@ -0,0 +1,32 @@
+package ordernumber
+
+import (
+	"fmt"
+	"regexp"
+)
+
+type regexValidator struct {
+	pattern *regexp.Regexp
+}
+
+// newRegexValidator accepts numbers matching the whole pattern.
+func newRegexValidator(pattern string) (*regexValidator, error) {
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid order number pattern %q: %w", pattern, err)
+	}
+
+	return &regexValidator{pattern: re}, nil
+}
+
+func (v *regexValidator) Validate(number string) error {
+	if err := checkFormat(number); err != nil {
+		return err
+	}
+
+	if !v.pattern.MatchString(number) {
+		return ErrInvalidNumber
+	}
+
+	return nil
+}
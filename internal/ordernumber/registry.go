@@ -0,0 +1,148 @@
+package ordernumber
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/koyif/gophermart/internal/config"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	SchemeLuhn     = "luhn"
+	SchemeVerhoeff = "verhoeff"
+	SchemeRegex    = "regex"
+)
+
+// schemesFile is the format of ORDER_NUMBER_SCHEMES_FILE:
+//
+//	{
+//	  "default": "luhn",
+//	  "schemes": {"acme": {"type": "regex", "pattern": "ACM-[0-9]{8}"}},
+//	  "merchants": {"acme-stores": "acme"},
+//	  "prefixes": {"99": "verhoeff"}
+//	}
+//
+// merchants maps the store IDs of the order metadata to their schemes, the
+// same IDs the accrual providers are routed by. The luhn and verhoeff schemes
+// are always defined.
+type schemesFile struct {
+	Default string `json:"default"`
+	Schemes map[string]struct {
+		Type    string `json:"type"`
+		Pattern string `json:"pattern"`
+	} `json:"schemes"`
+	Merchants map[string]string `json:"merchants"`
+	Prefixes  map[string]string `json:"prefixes"`
+}
+
+type prefixRule struct {
+	prefix    string
+	validator Validator
+}
+
+// Registry selects the validator of an order number: the scheme of the store
+// the order is uploaded with if it has one, otherwise the scheme of the
+// longest matching number prefix, otherwise the default scheme. A store
+// without a scheme of its own gets the same validator as no store at all.
+type Registry struct {
+	fallback Validator
+	stores   map[string]Validator
+	prefixes []prefixRule
+}
+
+// NewRegistry builds the registry from ORDER_NUMBER_SCHEMES_FILE. Without the
+// file every number is validated with Luhn.
+func NewRegistry(cfg *config.Config) (*Registry, error) {
+	r := &Registry{
+		fallback: luhnValidator{},
+		stores:   make(map[string]Validator),
+	}
+	if cfg.OrderNumberSchemesFile == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(cfg.OrderNumberSchemesFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading order number schemes: %w", err)
+	}
+
+	var file schemesFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing order number schemes: %w", err)
+	}
+
+	schemes := map[string]Validator{
+		SchemeLuhn:     luhnValidator{},
+		SchemeVerhoeff: verhoeffValidator{},
+	}
+	for name, scheme := range file.Schemes {
+		switch scheme.Type {
+		case SchemeLuhn:
+			schemes[name] = luhnValidator{}
+		case SchemeVerhoeff:
+			schemes[name] = verhoeffValidator{}
+		case SchemeRegex:
+			v, err := newRegexValidator(scheme.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			schemes[name] = v
+		default:
+			return nil, fmt.Errorf("order number scheme %q has unknown type %q", name, scheme.Type)
+		}
+	}
+
+	lookup := func(name string) (Validator, error) {
+		v, ok := schemes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown order number scheme %q", name)
+		}
+		return v, nil
+	}
+
+	if file.Default != "" {
+		if r.fallback, err = lookup(file.Default); err != nil {
+			return nil, err
+		}
+	}
+	for storeID, name := range file.Merchants {
+		if r.stores[storeID], err = lookup(name); err != nil {
+			return nil, err
+		}
+	}
+	for prefix, name := range file.Prefixes {
+		v, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		r.prefixes = append(r.prefixes, prefixRule{prefix: prefix, validator: v})
+	}
+	sort.Slice(r.prefixes, func(i, j int) bool {
+		return len(r.prefixes[i].prefix) > len(r.prefixes[j].prefix)
+	})
+
+	return r, nil
+}
+
+// Validator returns the validator for a number of the store with storeID,
+// storeID is empty for orders uploaded without purchase metadata and for
+// withdrawals.
+func (r *Registry) Validator(storeID, number string) Validator {
+	if v, ok := r.stores[storeID]; ok && storeID != "" {
+		return v
+	}
+
+	for _, rule := range r.prefixes {
+		if strings.HasPrefix(number, rule.prefix) {
+			return rule.validator
+		}
+	}
+
+	return r.fallback
+}
+
+func (r *Registry) Validate(storeID, number string) error {
+	return r.Validator(storeID, number).Validate(number)
+}
@@ -0,0 +1,49 @@
+package ordernumber
+
+import (
+	"errors"
+	"github.com/koyif/gophermart/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistryValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schemes.json")
+	err := os.WriteFile(path, []byte(`{
+		"schemes": {"acme": {"type": "regex", "pattern": "ACM-[0-9]{8}"}},
+		"merchants": {"acme-stores": "acme"},
+		"prefixes": {"99": "verhoeff"}
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := NewRegistry(&config.Config{OrderNumberSchemesFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		storeID string
+		number  string
+		want    error
+	}{
+		{name: "store scheme", storeID: "acme-stores", number: "ACM-12345678"},
+		{name: "store scheme rejects", storeID: "acme-stores", number: "12345678903", want: ErrInvalidNumber},
+		{name: "no store", number: "12345678903"},
+		{name: "no store ignores store schemes", number: "ACM-12345678", want: ErrInvalidFormat},
+		{name: "unknown store", storeID: "corner-shop", number: "ACM-12345678", want: ErrInvalidFormat},
+		{name: "unknown store gets default", storeID: "corner-shop", number: "12345678903"},
+		{name: "prefix", number: "991232"},
+		{name: "prefix rejects", number: "991233", want: ErrInvalidNumber},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := registry.Validate(tt.storeID, tt.number); !errors.Is(err, tt.want) {
+				t.Fatalf("Validate(%q, %q) = %v, want %v", tt.storeID, tt.number, err, tt.want)
+			}
+		})
+	}
+}
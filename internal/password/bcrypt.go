@@ -0,0 +1,58 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/koyif/gophermart/internal/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptMaxPasswordLength is the number of bytes bcrypt takes into account,
+// anything longer is rejected instead of being silently truncated.
+const bcryptMaxPasswordLength = 72
+
+type bcryptScheme struct {
+	cost int
+}
+
+func (s *bcryptScheme) Hash(password string) (string, error) {
+	if len(password) > bcryptMaxPasswordLength {
+		return "", domain.ErrPasswordTooLong
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password with bcrypt: %w", err)
+	}
+
+	return string(hashed), nil
+}
+
+func (s *bcryptScheme) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+func (s *bcryptScheme) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error comparing bcrypt hash: %w", err)
+	}
+
+	return true, nil
+}
+
+func (s *bcryptScheme) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return true
+	}
+
+	return cost != s.cost
+}
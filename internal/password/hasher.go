@@ -0,0 +1,89 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/koyif/gophermart/internal/config"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Hasher hashes passwords with the configured algorithm and verifies hashes
+// produced by any of the supported algorithms.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches the encoded hash and whether the
+	// hash should be replaced because it uses an outdated algorithm or parameters.
+	Verify(encoded, password string) (match bool, rehash bool, err error)
+}
+
+type scheme interface {
+	Hash(password string) (string, error)
+	Recognizes(encoded string) bool
+	Verify(encoded, password string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
+
+type hasher struct {
+	current scheme
+	schemes []scheme
+}
+
+// New returns the hasher of the configured algorithm. The argon2id parameters
+// are checked whatever the algorithm, argon2.IDKey panics on zero values.
+func New(cfg *config.Config) (Hasher, error) {
+	if cfg.Argon2Memory == 0 || cfg.Argon2Iterations == 0 || cfg.Argon2Parallelism == 0 {
+		return nil, fmt.Errorf(
+			"argon2id memory, iterations and parallelism must be positive, got %d, %d and %d",
+			cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism,
+		)
+	}
+
+	argon := &argon2idScheme{
+		memory:      cfg.Argon2Memory,
+		iterations:  cfg.Argon2Iterations,
+		parallelism: cfg.Argon2Parallelism,
+		saltLength:  argon2SaltLength,
+		keyLength:   argon2KeyLength,
+	}
+	bc := &bcryptScheme{cost: cfg.BcryptCost}
+
+	h := &hasher{schemes: []scheme{argon, bc}}
+	switch cfg.PasswordHashAlgorithm {
+	case AlgorithmArgon2id:
+		h.current = argon
+	case AlgorithmBcrypt:
+		h.current = bc
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", cfg.PasswordHashAlgorithm)
+	}
+
+	return h, nil
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *hasher) Verify(encoded, password string) (bool, bool, error) {
+	for _, s := range h.schemes {
+		if !s.Recognizes(encoded) {
+			continue
+		}
+
+		match, err := s.Verify(encoded, password)
+		if err != nil || !match {
+			return false, false, err
+		}
+
+		return true, s != h.current || s.NeedsRehash(encoded), nil
+	}
+
+	return false, false, ErrUnknownHashFormat
+}
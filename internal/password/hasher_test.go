@@ -0,0 +1,61 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/koyif/gophermart/internal/config"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		PasswordHashAlgorithm: AlgorithmArgon2id,
+		Argon2Memory:          64,
+		Argon2Iterations:      1,
+		Argon2Parallelism:     1,
+		BcryptCost:            4,
+	}
+}
+
+func TestNewRejectsZeroArgon2Parameters(t *testing.T) {
+	for name, unset := range map[string]func(*config.Config){
+		"memory":      func(cfg *config.Config) { cfg.Argon2Memory = 0 },
+		"iterations":  func(cfg *config.Config) { cfg.Argon2Iterations = 0 },
+		"parallelism": func(cfg *config.Config) { cfg.Argon2Parallelism = 0 },
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, algorithm := range []string{AlgorithmArgon2id, AlgorithmBcrypt} {
+				cfg := testConfig()
+				cfg.PasswordHashAlgorithm = algorithm
+				unset(cfg)
+
+				if _, err := New(cfg); err == nil {
+					t.Fatalf("New() with %s accepted a zero argon2id %s", algorithm, name)
+				}
+			}
+		})
+	}
+}
+
+func TestHasherVerify(t *testing.T) {
+	h, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if match, rehash, err := h.Verify(encoded, "correct horse"); err != nil || !match || rehash {
+		t.Fatalf("Verify() = %v, %v, %v, want a match without rehash", match, rehash, err)
+	}
+	if match, _, err := h.Verify(encoded, "wrong horse"); err != nil || match {
+		t.Fatalf("Verify() of a wrong password = %v, %v, want no match", match, err)
+	}
+
+	// A stored hash with zero parameters is refused rather than panicking.
+	if _, _, err := h.Verify("$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHRzYWx0c2FsdA$a2V5", "correct horse"); err == nil {
+		t.Fatal("Verify() accepted a hash with zero parallelism")
+	}
+}
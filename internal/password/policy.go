@@ -0,0 +1,111 @@
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/koyif/gophermart/internal/config"
+	"github.com/koyif/gophermart/internal/domain"
+)
+
+const (
+	ClassLower   = "lower"
+	ClassUpper   = "upper"
+	ClassDigit   = "digit"
+	ClassSpecial = "special"
+)
+
+var classCheckers = map[string]func(r rune) bool{
+	ClassLower:   unicode.IsLower,
+	ClassUpper:   unicode.IsUpper,
+	ClassDigit:   unicode.IsDigit,
+	ClassSpecial: func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r) },
+}
+
+// Policy describes the requirements a new password has to satisfy.
+type Policy struct {
+	minLength       int
+	requiredClasses []string
+	blocklist       map[string]struct{}
+}
+
+func NewPolicy(cfg *config.Config) (*Policy, error) {
+	p := &Policy{
+		minLength: cfg.PasswordMinLength,
+	}
+
+	for _, class := range cfg.PasswordRequiredClasses {
+		class = strings.TrimSpace(strings.ToLower(class))
+		if class == "" {
+			continue
+		}
+		if _, ok := classCheckers[class]; !ok {
+			return nil, fmt.Errorf("unknown password character class %q", class)
+		}
+		p.requiredClasses = append(p.requiredClasses, class)
+	}
+
+	if cfg.PasswordBlocklistFile != "" {
+		blocklist, err := loadBlocklist(cfg.PasswordBlocklistFile)
+		if err != nil {
+			return nil, err
+		}
+		p.blocklist = blocklist
+	}
+
+	return p, nil
+}
+
+// Validate returns an error wrapping domain.ErrWeakPassword that lists every
+// requirement the password does not meet.
+func (p *Policy) Validate(password string) error {
+	var violations []string
+
+	if utf8.RuneCountInString(password) < p.minLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.minLength))
+	}
+
+	for _, class := range p.requiredClasses {
+		if !strings.ContainsFunc(password, classCheckers[class]) {
+			violations = append(violations, fmt.Sprintf("must contain a %s character", class))
+		}
+	}
+
+	if _, ok := p.blocklist[strings.ToLower(password)]; ok {
+		violations = append(violations, "is known to have been exposed in a data breach")
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: password %s", domain.ErrWeakPassword, strings.Join(violations, ", "))
+}
+
+func loadBlocklist(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening password blocklist: %w", err)
+	}
+	defer f.Close()
+
+	blocklist := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocklist[strings.ToLower(line)] = struct{}{}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading password blocklist: %w", err)
+	}
+
+	return blocklist, nil
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+)
+
+func (p *Postgres) BalanceHistory(userID int64) ([]domain.BalanceChange, error) {
+	rows, err := p.DB.Query(
+		"SELECT user_id, kind, amount, reference, created_at FROM balance_history WHERE user_id = $1 ORDER BY created_at, id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching balance history: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error closing rows", logger.Error(err))
+		}
+	}(rows)
+
+	var history []domain.BalanceChange
+	for rows.Next() {
+		var change domain.BalanceChange
+		err := rows.Scan(&change.UserID, &change.Kind, &change.Amount, &change.Reference, &change.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning balance change: %w", err)
+		}
+		history = append(history, change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over balance history: %w", err)
+	}
+
+	return history, nil
+}
+
+// DeleteUser anonymizes the account and removes the data that is not needed
+// for accounting. Orders, withdrawals and the balance ledger keep pointing to
+// the anonymized row.
+func (p *Postgres) DeleteUser(userID int64) error {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	res, err := tx.Exec(
+		`UPDATE users
+		 SET login = '#deleted-' || id, password = '', totp_secret = NULL, totp_enabled = FALSE, status = 'closed', deleted_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND deleted_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("error anonymizing user: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error anonymizing user: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	for _, query := range []string{
+		"DELETE FROM recovery_codes WHERE user_id = $1",
+		"DELETE FROM two_factor_challenges WHERE user_id = $1",
+		"DELETE FROM sessions WHERE user_id = $1",
+	} {
+		if _, err = tx.Exec(query, userID); err != nil {
+			return fmt.Errorf("error deleting personal data: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AcquireAccrualRequest takes a request off the budget the replicas share for
+// the accrual provider: budget requests per window, 0 for no limit. If there
+// is none left it returns how long to wait and whether the provider is backing
+// off rather than out of budget. Without a limit only the backoff is read,
+// otherwise the row of the provider is locked while the budget is taken, so
+// the replicas never exceed it together.
+func (p *Postgres) AcquireAccrualRequest(provider string, budget int, window time.Duration) (time.Duration, bool, error) {
+	var backoff *float64
+	err := p.DB.QueryRow(
+		"SELECT EXTRACT(EPOCH FROM backoff_until - CURRENT_TIMESTAMP)::float8 FROM accrual_rate_limits WHERE provider = $1",
+		provider,
+	).Scan(&backoff)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, fmt.Errorf("error fetching accrual backoff: %w", err)
+	}
+	if backoff != nil && *backoff > 0 {
+		return seconds(*backoff), true, nil
+	}
+	if budget <= 0 {
+		return 0, false, nil
+	}
+
+	return p.takeAccrualBudget(provider, budget, window)
+}
+
+// takeAccrualBudget takes a request off the budget with the row of the
+// provider locked. The backoff is read again, another replica may have started
+// one in the meantime.
+func (p *Postgres) takeAccrualBudget(provider string, budget int, window time.Duration) (time.Duration, bool, error) {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	_, err = tx.Exec("INSERT INTO accrual_rate_limits (provider) VALUES ($1) ON CONFLICT (provider) DO NOTHING", provider)
+	if err != nil {
+		return 0, false, fmt.Errorf("error creating accrual rate limit: %w", err)
+	}
+
+	var (
+		backoff    *float64
+		windowLeft *float64
+		requests   int
+	)
+	err = tx.QueryRow(
+		`SELECT EXTRACT(EPOCH FROM backoff_until - CURRENT_TIMESTAMP)::float8,
+		        EXTRACT(EPOCH FROM window_start + make_interval(secs => $2) - CURRENT_TIMESTAMP)::float8,
+		        window_requests
+		 FROM accrual_rate_limits
+		 WHERE provider = $1
+		 FOR UPDATE`,
+		provider, window.Seconds(),
+	).Scan(&backoff, &windowLeft, &requests)
+	if err != nil {
+		return 0, false, fmt.Errorf("error fetching accrual rate limit: %w", err)
+	}
+
+	if backoff != nil && *backoff > 0 {
+		return seconds(*backoff), true, nil
+	}
+
+	switch {
+	case windowLeft == nil || *windowLeft <= 0:
+		_, err = tx.Exec(
+			"UPDATE accrual_rate_limits SET window_start = CURRENT_TIMESTAMP, window_requests = 1 WHERE provider = $1",
+			provider,
+		)
+	case requests < budget:
+		_, err = tx.Exec(
+			"UPDATE accrual_rate_limits SET window_requests = window_requests + 1 WHERE provider = $1",
+			provider,
+		)
+	default:
+		return seconds(*windowLeft), false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error updating accrual rate limit: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return 0, false, nil
+}
+
+// BackOffAccrual pauses the requests of all replicas to the accrual provider
+// for d, unless it is already backing off for longer.
+func (p *Postgres) BackOffAccrual(provider string, d time.Duration) error {
+	_, err := p.DB.Exec(
+		`INSERT INTO accrual_rate_limits (provider, backoff_until)
+		 VALUES ($1, CURRENT_TIMESTAMP + make_interval(secs => $2))
+		 ON CONFLICT (provider) DO UPDATE
+		     SET backoff_until = GREATEST(accrual_rate_limits.backoff_until, EXCLUDED.backoff_until)`,
+		provider, d.Seconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("error storing accrual backoff: %w", err)
+	}
+
+	return nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAcquireAccrualRequestSharesBudget(t *testing.T) {
+	p := newTestPostgres(t)
+
+	for i := 0; i < 2; i++ {
+		wait, backingOff, err := p.AcquireAccrualRequest("partner", 2, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait != 0 || backingOff {
+			t.Fatalf("request %d: wait = %v, backing off = %v, want none", i+1, wait, backingOff)
+		}
+	}
+
+	wait, backingOff, err := p.AcquireAccrualRequest("partner", 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait <= 0 || wait > time.Hour || backingOff {
+		t.Fatalf("over budget: wait = %v, backing off = %v, want the rest of the window", wait, backingOff)
+	}
+
+	// Budgets are per provider.
+	if wait, _, err = p.AcquireAccrualRequest("other", 2, time.Hour); err != nil || wait != 0 {
+		t.Fatalf("other provider: wait = %v, err = %v, want none", wait, err)
+	}
+}
+
+func TestAcquireAccrualRequestBacksOff(t *testing.T) {
+	p := newTestPostgres(t)
+
+	// A provider without a limit has no row until it backs off.
+	wait, backingOff, err := p.AcquireAccrualRequest("partner", 0, time.Second)
+	if err != nil || wait != 0 || backingOff {
+		t.Fatalf("no limit: wait = %v, backing off = %v, err = %v, want none", wait, backingOff, err)
+	}
+
+	if err = p.BackOffAccrual("partner", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// A shorter backoff doesn't cut the current one.
+	if err = p.BackOffAccrual("partner", time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, budget := range []int{0, 5} {
+		wait, backingOff, err = p.AcquireAccrualRequest("partner", budget, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !backingOff || wait <= 30*time.Second || wait > time.Minute {
+			t.Fatalf("budget %d: wait = %v, backing off = %v, want the backoff", budget, wait, backingOff)
+		}
+	}
+}
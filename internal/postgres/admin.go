@@ -0,0 +1,292 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+	"strconv"
+)
+
+const userSummaryColumns = "id, login, totp_enabled, " + userRolesColumn + ", status, registered_at, balance, withdrawn, deleted_at IS NOT NULL"
+
+func (p *Postgres) SearchUsers(login string, limit, offset int) ([]domain.UserSummary, error) {
+	rows, err := p.DB.Query(
+		"SELECT "+userSummaryColumns+" FROM users WHERE login ILIKE '%' || $1 || '%' ORDER BY id LIMIT $2 OFFSET $3",
+		login, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error searching users: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error closing rows", logger.Error(err))
+		}
+	}(rows)
+
+	var users []domain.UserSummary
+	for rows.Next() {
+		user, err := scanUserSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over users: %w", err)
+	}
+
+	return users, nil
+}
+
+func (p *Postgres) UserSummary(userID int64) (*domain.UserSummary, error) {
+	user, err := scanUserSummary(p.DB.QueryRow("SELECT "+userSummaryColumns+" FROM users WHERE id = $1", userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (p *Postgres) RecordAdminAction(action domain.AdminAction) error {
+	_, err := insertAdminAction(p.DB, action)
+
+	return err
+}
+
+// RequeueOrder moves an order that hasn't been credited yet back to NEW, so
+// that the accrual workers check it again.
+func (p *Postgres) RequeueOrder(number string, action domain.AdminAction) error {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	var (
+		orderID int64
+		status  string
+	)
+	err = tx.QueryRow("SELECT id, status FROM orders WHERE number = $1 AND status <> 'CANCELLED' FOR UPDATE", number).Scan(&orderID, &status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrOrderNotFound
+		}
+		return fmt.Errorf("error fetching order: %w", err)
+	}
+	if status == "PROCESSED" {
+		return domain.ErrOrderAlreadyProcessed
+	}
+
+	_, err = tx.Exec("UPDATE orders SET status = 'NEW', accrual = NULL, status_changed_at = CURRENT_TIMESTAMP WHERE id = $1", orderID)
+	if err != nil {
+		return fmt.Errorf("error requeueing order: %w", err)
+	}
+
+	if err = insertOrderStatusChange(tx, orderID, "NEW", nil, nil); err != nil {
+		return err
+	}
+
+	if _, err = insertAdminAction(tx, action); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ReassignOrder moves an order that hasn't been credited yet to another user.
+// The previous owner is recorded in the details of the admin action.
+func (p *Postgres) ReassignOrder(number string, userID int64, action domain.AdminAction) error {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	var (
+		orderID int64
+		ownerID int64
+		status  string
+	)
+	err = tx.QueryRow("SELECT id, user_id, status FROM orders WHERE number = $1 AND status <> 'CANCELLED' FOR UPDATE", number).
+		Scan(&orderID, &ownerID, &status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrOrderNotFound
+		}
+		return fmt.Errorf("error fetching order: %w", err)
+	}
+	if status == "PROCESSED" {
+		return domain.ErrOrderAlreadyProcessed
+	}
+
+	res, err := tx.Exec(
+		"UPDATE orders SET user_id = $1 WHERE id = $2 AND EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)",
+		userID, orderID,
+	)
+	if err != nil {
+		return fmt.Errorf("error reassigning order: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error reassigning order: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	action.Details = fmt.Sprintf(`{"from_user_id": %d, "to_user_id": %d}`, ownerID, userID)
+	if _, err = insertAdminAction(tx, action); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// SetUserStatus changes the status of a user that hasn't deleted the account.
+func (p *Postgres) SetUserStatus(userID int64, status string, action domain.AdminAction) error {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	res, err := tx.Exec("UPDATE users SET status = $1 WHERE id = $2 AND deleted_at IS NULL", status, userID)
+	if err != nil {
+		return fmt.Errorf("error updating user status: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error updating user status: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	if _, err = insertAdminAction(tx, action); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// AdjustBalance credits (positive amount) or debits (negative amount) the
+// user's balance. A debit can't make the balance negative.
+func (p *Postgres) AdjustBalance(userID int64, amount float64, action domain.AdminAction) (*domain.Balance, error) {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	var balance domain.Balance
+	err = tx.QueryRow("SELECT balance, withdrawn FROM users WHERE id = $1 FOR UPDATE", userID).
+		Scan(&balance.Current, &balance.Withdrawn)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error fetching balance: %w", err)
+	}
+
+	if balance.Current+amount < 0 {
+		return nil, domain.ErrInsufficientFunds
+	}
+
+	actionID, err := insertAdminAction(tx, action)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE users SET balance = balance + $1 WHERE id = $2", amount, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error adjusting balance: %w", err)
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO balance_history (user_id, kind, amount, reference) VALUES ($1, $2, $3, $4)",
+		userID, domain.BalanceChangeAdjustment, amount, strconv.FormatInt(actionID, 10),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting balance history: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	balance.Current += amount
+
+	return &balance, nil
+}
+
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func insertAdminAction(db rowQuerier, action domain.AdminAction) (int64, error) {
+	var details *string
+	if action.Details != "" {
+		details = &action.Details
+	}
+
+	var id int64
+	err := db.QueryRow(
+		"INSERT INTO admin_actions (admin_id, action, target_type, target_id, reason, details) VALUES ($1, $2, $3, $4, $5, $6::jsonb) RETURNING id",
+		action.AdminID, action.Action, action.TargetType, action.TargetID, action.Reason, details,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error recording admin action: %w", err)
+	}
+
+	return id, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUserSummary(row rowScanner) (*domain.UserSummary, error) {
+	var (
+		user  domain.UserSummary
+		roles string
+	)
+	err := row.Scan(
+		&user.ID,
+		&user.Login,
+		&user.TwoFactor,
+		&roles,
+		&user.Status,
+		&user.RegisteredAt,
+		&user.Balance.Current,
+		&user.Balance.Withdrawn,
+		&user.Deleted,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning user: %w", err)
+	}
+	user.Roles = splitRoles(roles)
+
+	return &user, nil
+}
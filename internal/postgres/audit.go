@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+	"strconv"
+	"strings"
+)
+
+func (p *Postgres) RecordAuditEvent(event domain.AuditEvent) error {
+	var details *string
+	if event.Details != "" {
+		details = &event.Details
+	}
+
+	_, err := p.DB.Exec(
+		"INSERT INTO audit_events (actor_id, ip, event_type, target_type, target_id, outcome, reason, details) VALUES ($1, $2, $3, $4, $5, $6, $7, $8::jsonb)",
+		event.ActorID, event.IP, event.Type, event.TargetType, event.TargetID, event.Outcome, event.Reason, details,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording audit event: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) AuditEvents(filter domain.AuditFilter) ([]domain.AuditEvent, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if filter.ActorID != nil {
+		where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Type != "" {
+		where("event_type = ?", filter.Type)
+	}
+	if filter.TargetType != "" {
+		where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		where("target_id = ?", filter.TargetID)
+	}
+	if filter.Outcome != "" {
+		where("outcome = ?", filter.Outcome)
+	}
+	if !filter.From.IsZero() {
+		where("occurred_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		where("occurred_at < ?", filter.To)
+	}
+
+	query := "SELECT id, occurred_at, actor_id, ip, event_type, target_type, target_id, outcome, reason, COALESCE(details::text, '') FROM audit_events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := p.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching audit events: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error closing rows", logger.Error(err))
+		}
+	}(rows)
+
+	var events []domain.AuditEvent
+	for rows.Next() {
+		var (
+			event   domain.AuditEvent
+			actorID sql.NullInt64
+		)
+		err = rows.Scan(
+			&event.ID,
+			&event.OccurredAt,
+			&actorID,
+			&event.IP,
+			&event.Type,
+			&event.TargetType,
+			&event.TargetID,
+			&event.Outcome,
+			&event.Reason,
+			&event.Details,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning audit event: %w", err)
+		}
+		if actorID.Valid {
+			event.ActorID = &actorID.Int64
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over audit events: %w", err)
+	}
+
+	return events, nil
+}
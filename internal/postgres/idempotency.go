@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"time"
+)
+
+// ClaimIdempotencyKey reserves the key for a request for the lease. It returns
+// nil if the key is new, has expired or has been left in progress past its
+// lease, otherwise the response stored for it, without a status code if the
+// request is still in progress.
+func (p *Postgres) ClaimIdempotencyKey(userID int64, key, requestHash string, lease time.Duration) (*domain.IdempotentResponse, error) {
+	var claimed bool
+	err := p.DB.QueryRow(
+		`INSERT INTO idempotency_keys (user_id, key, request_hash, expires_at)
+		 VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(secs => $4))
+		 ON CONFLICT (user_id, key) DO UPDATE
+		     SET request_hash  = EXCLUDED.request_hash,
+		         status_code   = NULL,
+		         content_type  = '',
+		         response_body = NULL,
+		         created_at    = CURRENT_TIMESTAMP,
+		         expires_at    = EXCLUDED.expires_at
+		 WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+		 RETURNING TRUE`,
+		userID, key, requestHash, lease.Seconds(),
+	).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error claiming idempotency key: %w", err)
+	}
+
+	var (
+		stored     domain.IdempotentResponse
+		statusCode sql.NullInt64
+	)
+	err = p.DB.QueryRow(
+		"SELECT request_hash, status_code, content_type, COALESCE(response_body, '') FROM idempotency_keys WHERE user_id = $1 AND key = $2",
+		userID, key,
+	).Scan(&stored.RequestHash, &statusCode, &stored.ContentType, &stored.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching idempotency key: %w", err)
+	}
+	stored.StatusCode = int(statusCode.Int64)
+
+	return &stored, nil
+}
+
+// CompleteIdempotencyKey stores the response to the request holding the key
+// and keeps it for the ttl.
+func (p *Postgres) CompleteIdempotencyKey(userID int64, key string, response domain.IdempotentResponse, ttl time.Duration) error {
+	_, err := p.DB.Exec(
+		`UPDATE idempotency_keys
+		 SET status_code = $1, content_type = $2, response_body = $3,
+		     expires_at = CURRENT_TIMESTAMP + make_interval(secs => $6)
+		 WHERE user_id = $4 AND key = $5`,
+		response.StatusCode, response.ContentType, response.Body, userID, key, ttl.Seconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("error storing idempotent response: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) ReleaseIdempotencyKey(userID int64, key string) error {
+	_, err := p.DB.Exec("DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2", userID, key)
+	if err != nil {
+		return fmt.Errorf("error releasing idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) DeleteExpiredIdempotencyKeys() (int64, error) {
+	res, err := p.DB.Exec("DELETE FROM idempotency_keys WHERE expires_at <= CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired idempotency keys: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired idempotency keys: %w", err)
+	}
+
+	return n, nil
+}
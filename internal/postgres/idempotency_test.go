@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"github.com/koyif/gophermart/internal/domain"
+	"testing"
+	"time"
+)
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	p := newTestPostgres(t)
+	userID, err := p.CreateUser("user", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored, err := p.ClaimIdempotencyKey(userID, "key", "hash", time.Minute); err != nil || stored != nil {
+		t.Fatalf("first claim = %+v, %v, want the key claimed", stored, err)
+	}
+
+	stored, err := p.ClaimIdempotencyKey(userID, "key", "hash", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.StatusCode != 0 {
+		t.Fatalf("claim while in progress = %+v, want no response yet", stored)
+	}
+
+	response := domain.IdempotentResponse{StatusCode: 202, ContentType: "text/plain", Body: []byte("accepted")}
+	if err = p.CompleteIdempotencyKey(userID, "key", response, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err = p.ClaimIdempotencyKey(userID, "key", "hash", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.StatusCode != 202 || string(stored.Body) != "accepted" || stored.RequestHash != "hash" {
+		t.Fatalf("claim after completion = %+v, want the stored response", stored)
+	}
+}
+
+func TestClaimIdempotencyKeyAfterLease(t *testing.T) {
+	p := newTestPostgres(t)
+	userID, err := p.CreateUser("user", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The request holding the key never finishes, its lease is over at once.
+	if _, err = p.ClaimIdempotencyKey(userID, "key", "hash", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := p.ClaimIdempotencyKey(userID, "key", "other", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != nil {
+		t.Fatalf("claim after the lease = %+v, want the key claimed again", stored)
+	}
+}
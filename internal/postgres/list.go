@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+	"strconv"
+	"strings"
+)
+
+// ListOrders returns a page of the user's orders in upload order. One row more
+// than the limit is fetched so that the caller can tell whether there is a
+// next page, all of them without a limit. Cancelled orders are left out unless
+// they are asked for, their number may have been uploaded again.
+func (p *Postgres) ListOrders(userID int64, query domain.ListQuery) ([]domain.Order, error) {
+	var conditions []string
+	if query.Status == "" {
+		conditions = append(conditions, "status <> 'CANCELLED'")
+	}
+
+	sqlQuery, args := listQuery("SELECT "+orderColumns+" FROM orders", "uploaded_at", userID, query, conditions...)
+	rows, err := p.DB.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching orders: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error closing rows", logger.Error(err))
+		}
+	}(rows)
+
+	var orders []domain.Order
+	for rows.Next() {
+		var order domain.Order
+		err := rows.Scan(orderFields(&order)...)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+// ListWithdrawals returns a page of the user's withdrawals, see ListOrders.
+func (p *Postgres) ListWithdrawals(userID int64, query domain.ListQuery) ([]domain.Withdrawal, error) {
+	sqlQuery, args := listQuery("SELECT id, user_id, order_number, amount, processed_at FROM withdrawals", "processed_at", userID, query)
+	rows, err := p.DB.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching withdrawals: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error closing rows", logger.Error(err))
+		}
+	}(rows)
+
+	var withdrawals []domain.Withdrawal
+	for rows.Next() {
+		var withdrawal domain.Withdrawal
+		err := rows.Scan(&withdrawal.ID, &withdrawal.UserID, &withdrawal.OrderNumber, &withdrawal.Amount, &withdrawal.ProcessedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning withdrawal: %w", err)
+		}
+		withdrawals = append(withdrawals, withdrawal)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over withdrawals: %w", err)
+	}
+
+	return withdrawals, nil
+}
+
+// listQuery builds a keyset-paginated query over the user's rows ordered by
+// (timeColumn, id), which is served by the (user_id, timeColumn, id) index.
+// The fixed conditions take no arguments.
+func listQuery(selectFrom, timeColumn string, userID int64, query domain.ListQuery, fixed ...string) (string, []any) {
+	args := []any{userID}
+	conditions := append([]string{"user_id = $1"}, fixed...)
+	where := func(condition string, values ...any) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	direction, comparison := "DESC", "<"
+	if query.Sort == domain.SortAsc {
+		direction, comparison = "ASC", ">"
+	}
+
+	if query.After != nil {
+		where("("+timeColumn+", id) "+comparison+" (?, ?)", query.After.At, query.After.ID)
+	}
+	if query.Status != "" {
+		where("status = ?", query.Status)
+	}
+	if !query.From.IsZero() {
+		where(timeColumn+" >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		where(timeColumn+" < ?", query.To)
+	}
+
+	sqlQuery := fmt.Sprintf(
+		"%s WHERE %s ORDER BY %s %s, id %s",
+		selectFrom, strings.Join(conditions, " AND "), timeColumn, direction, direction,
+	)
+	if query.Limit > 0 {
+		args = append(args, query.Limit+1)
+		sqlQuery += " LIMIT $" + strconv.Itoa(len(args))
+	}
+
+	return sqlQuery, args
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+)
+
+// CreateOrders uploads a batch of orders in a single statement and reports the
+// result for every distinct number. A number inserted concurrently by another
+// transaction isn't visible to the statement and is reported as belonging to
+// another user.
+func (p *Postgres) CreateOrders(numbers []string, userID int64) ([]domain.OrderUpload, error) {
+	rows, err := p.DB.Query(
+		`WITH input AS (
+		     SELECT DISTINCT number FROM unnest($1::varchar[]) AS t (number)
+		 ),
+		 inserted AS (
+		     INSERT INTO orders (number, user_id)
+		     SELECT number, $2 FROM input
+		     ON CONFLICT (number) WHERE status <> 'CANCELLED' DO NOTHING
+		     RETURNING id, number
+		 ),
+		 history AS (
+		     INSERT INTO order_status_history (order_id, status)
+		     SELECT id, 'NEW' FROM inserted
+		 )
+		 SELECT input.number, inserted.id IS NOT NULL, COALESCE(orders.user_id, 0)
+		 FROM input
+		          LEFT JOIN inserted ON inserted.number = input.number
+		          LEFT JOIN orders ON orders.number = input.number AND orders.status <> 'CANCELLED'`,
+		numbers, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating orders: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error closing rows", logger.Error(err))
+		}
+	}(rows)
+
+	var uploads []domain.OrderUpload
+	for rows.Next() {
+		var (
+			upload   domain.OrderUpload
+			inserted bool
+			ownerID  int64
+		)
+		if err := rows.Scan(&upload.Number, &inserted, &ownerID); err != nil {
+			return nil, fmt.Errorf("error scanning order upload: %w", err)
+		}
+
+		switch {
+		case inserted:
+			upload.Result = domain.OrderUploadAccepted
+		case ownerID == userID:
+			upload.Result = domain.OrderUploadAlreadyUploaded
+		default:
+			upload.Result = domain.OrderUploadAnotherUser
+		}
+		uploads = append(uploads, upload)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over order uploads: %w", err)
+	}
+
+	return uploads, nil
+}
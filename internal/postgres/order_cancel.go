@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+)
+
+// CancelOrder turns an order of the user the accrual system hasn't started on
+// into a CANCELLED tombstone. The accrual workers don't pick it up anymore and
+// the number can be uploaded again. Only NEW orders can be cancelled: once the
+// accrual system reports an order, REGISTERED or PROCESSING alike, it becomes
+// PROCESSING here. Goods of the order must not be in the middle of their
+// registration either.
+func (p *Postgres) CancelOrder(userID int64, number string) error {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	var (
+		orderID      int64
+		status       string
+		registration sql.NullString
+	)
+	err = tx.QueryRow(
+		"SELECT id, status, registration_status FROM orders WHERE number = $1 AND user_id = $2 AND status <> 'CANCELLED' FOR UPDATE",
+		number, userID,
+	).Scan(&orderID, &status, &registration)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrOrderNotFound
+		}
+		return fmt.Errorf("error fetching order: %w", err)
+	}
+	if status != "NEW" || (registration.Valid && registration.String != domain.OrderRegistrationRegistered) {
+		return domain.ErrOrderNotCancellable
+	}
+
+	_, err = tx.Exec(
+		"UPDATE orders SET status = 'CANCELLED', cancelled_at = CURRENT_TIMESTAMP, status_changed_at = CURRENT_TIMESTAMP WHERE id = $1",
+		orderID,
+	)
+	if err != nil {
+		return fmt.Errorf("error cancelling order: %w", err)
+	}
+
+	if err = insertOrderStatusChange(tx, orderID, "CANCELLED", nil, nil); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
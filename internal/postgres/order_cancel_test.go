@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"errors"
+	"github.com/koyif/gophermart/internal/domain"
+	"testing"
+)
+
+func TestCancelOrder(t *testing.T) {
+	p := newTestPostgres(t)
+	order := createOrder(t, p, "user", "12345678903")
+
+	if err := p.CancelOrder(order.UserID, order.Number); err != nil {
+		t.Fatal(err)
+	}
+
+	orders, err := p.ListOrders(order.UserID, domain.ListQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 0 {
+		t.Fatalf("listed %d orders, want the tombstone hidden", len(orders))
+	}
+	cancelled, err := p.ListOrders(order.UserID, domain.ListQuery{Status: "CANCELLED"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cancelled) != 1 {
+		t.Fatalf("listed %d cancelled orders, want the tombstone", len(cancelled))
+	}
+
+	pending, err := p.FetchPendingOrders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("%d orders pending, want the cancelled one left out", len(pending))
+	}
+
+	history, err := p.OrderHistory(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) == 0 || history[len(history)-1].Status != "CANCELLED" {
+		t.Fatalf("history = %+v, want the cancellation recorded", history)
+	}
+
+	// The number is free for its real owner.
+	owner, err := p.CreateUser("owner", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.CreateOrder(order.Number, owner, domain.OrderMetadata{}, false); err != nil {
+		t.Fatalf("upload after cancellation: %v", err)
+	}
+	if got := orderByNumber(t, p, order.Number); got.UserID != owner || got.Status != "NEW" {
+		t.Fatalf("order by number = %+v, want the new upload", got)
+	}
+}
+
+func TestCancelOrderRefused(t *testing.T) {
+	p := newTestPostgres(t)
+
+	processing := createOrder(t, p, "processing", "12345678903")
+	if _, err := p.ApplyAccrualCheck(domain.AccrualCheck{Order: *processing, Status: "PROCESSING"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CancelOrder(processing.UserID, processing.Number); !errors.Is(err, domain.ErrOrderNotCancellable) {
+		t.Fatalf("cancelling a processing order: %v, want ErrOrderNotCancellable", err)
+	}
+
+	other := createOrder(t, p, "other", "79927398713")
+	if err := p.CancelOrder(processing.UserID, other.Number); !errors.Is(err, domain.ErrOrderNotFound) {
+		t.Fatalf("cancelling an order of another user: %v, want ErrOrderNotFound", err)
+	}
+}
+
+func TestCancelOrderBeingRegistered(t *testing.T) {
+	p := newTestPostgres(t)
+	userID, err := p.CreateUser("user", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goods := domain.OrderMetadata{Goods: []domain.OrderGood{{Description: "Teapot", Price: 7000}}}
+	if err = p.CreateOrder("12345678903", userID, goods, true); err != nil {
+		t.Fatal(err)
+	}
+	order := orderByNumber(t, p, "12345678903")
+
+	if err = p.CancelOrder(userID, order.Number); !errors.Is(err, domain.ErrOrderNotCancellable) {
+		t.Fatalf("cancelling an order being registered: %v, want ErrOrderNotCancellable", err)
+	}
+
+	if err = p.MarkOrderRegistered(order.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.CancelOrder(userID, order.Number); err != nil {
+		t.Fatalf("cancelling a registered order: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+)
+
+// ApplyAccrualCheck moves an order to the status reported by the accrual
+// system, records the change with the raw response and credits the accrual of
+// a processed order, all in one transaction. It reports false without changing
+// anything if the order is no longer in the status the check was made for,
+// e.g. because it has been requeued or processed in the meantime, or if it has
+// reached a final status. The provider
+// of the check is kept with the order, unless the check doesn't name one.
+func (p *Postgres) ApplyAccrualCheck(check domain.AccrualCheck) (bool, error) {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	res, err := tx.Exec(
+		`UPDATE orders
+		 SET status = $1, accrual = $2, status_changed_at = CURRENT_TIMESTAMP,
+		     last_checked_at = CURRENT_TIMESTAMP, check_count = check_count + 1,
+		     accrual_provider = COALESCE(NULLIF($5, ''), accrual_provider)
+		 WHERE id = $3 AND status = $4 AND status NOT IN ('PROCESSED', 'INVALID', 'CANCELLED')`,
+		check.Status, check.Accrual, check.Order.ID, check.Order.Status, check.Provider,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error updating order status: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error updating order status: %w", err)
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	var response *string
+	if check.Response != "" {
+		response = &check.Response
+	}
+	if err = insertOrderStatusChange(tx, check.Order.ID, check.Status, check.Accrual, response); err != nil {
+		return false, err
+	}
+
+	if check.Status == "PROCESSED" && check.Accrual != nil {
+		_, err = tx.Exec("UPDATE users SET balance = balance + $1 WHERE id = $2", *check.Accrual, check.Order.UserID)
+		if err != nil {
+			return false, fmt.Errorf("error updating user balance: %w", err)
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO balance_history (user_id, kind, amount, reference) VALUES ($1, $2, $3, $4)",
+			check.Order.UserID, domain.BalanceChangeAccrual, *check.Accrual, check.Order.Number,
+		)
+		if err != nil {
+			return false, fmt.Errorf("error inserting balance history: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+func (p *Postgres) OrderHistory(orderID int64) ([]domain.OrderStatusChange, error) {
+	rows, err := p.DB.Query(
+		"SELECT status, accrual, COALESCE(accrual_response::text, ''), changed_at FROM order_status_history WHERE order_id = $1 ORDER BY id",
+		orderID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching order history: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error closing rows", logger.Error(err))
+		}
+	}(rows)
+
+	var history []domain.OrderStatusChange
+	for rows.Next() {
+		var change domain.OrderStatusChange
+		err := rows.Scan(&change.Status, &change.Accrual, &change.AccrualResponse, &change.ChangedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning order history: %w", err)
+		}
+		history = append(history, change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over order history: %w", err)
+	}
+
+	return history, nil
+}
+
+// OrderByNumber returns an order regardless of its owner, the live one if
+// the number has been cancelled and uploaded again.
+func (p *Postgres) OrderByNumber(number string) (*domain.Order, error) {
+	return scanOrderDetails(p.DB.QueryRow(
+		"SELECT "+orderDetailsColumns+" FROM orders WHERE number = $1 ORDER BY status = 'CANCELLED', id DESC LIMIT 1",
+		number,
+	))
+}
+
+const (
+	orderColumns        = "id, number, user_id, status, accrual, uploaded_at, COALESCE(store_id, ''), purchase_amount, COALESCE(currency, ''), purchased_at, COALESCE(registration_status, '')"
+	orderDetailsColumns = orderColumns + ", status_changed_at, last_checked_at, check_count, goods, COALESCE(accrual_provider, '')"
+)
+
+// orderFields returns the scan destinations of orderColumns.
+func orderFields(order *domain.Order) []any {
+	return []any{
+		&order.ID,
+		&order.Number,
+		&order.UserID,
+		&order.Status,
+		&order.Accrual,
+		&order.UploadedAt,
+		&order.Metadata.StoreID,
+		&order.Metadata.PurchaseAmount,
+		&order.Metadata.Currency,
+		&order.Metadata.PurchasedAt,
+		&order.RegistrationStatus,
+	}
+}
+
+func scanOrderDetails(row rowScanner) (*domain.Order, error) {
+	var (
+		order domain.Order
+		goods []byte
+	)
+	err := row.Scan(append(orderFields(&order), &order.StatusChangedAt, &order.LastCheckedAt, &order.CheckCount, &goods, &order.AccrualProvider)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("error fetching order: %w", err)
+	}
+
+	if order.Metadata.Goods, err = decodeGoods(goods); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insertOrderStatusChange(db execer, orderID int64, status string, accrual *float64, response *string) error {
+	_, err := db.Exec(
+		"INSERT INTO order_status_history (order_id, status, accrual, accrual_response) VALUES ($1, $2, $3, $4::jsonb)",
+		orderID, status, accrual, response,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording order status change: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"github.com/koyif/gophermart/internal/domain"
+	"testing"
+)
+
+func TestApplyAccrualCheckStoresProvider(t *testing.T) {
+	p := newTestPostgres(t)
+	order := createOrder(t, p, "user", "12345678903")
+
+	applied, err := p.ApplyAccrualCheck(domain.AccrualCheck{Order: *order, Status: "PROCESSING", Provider: "partner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !applied {
+		t.Fatal("check not applied")
+	}
+	if got := orderByNumber(t, p, order.Number).AccrualProvider; got != "partner" {
+		t.Fatalf("accrual provider = %q, want %q", got, "partner")
+	}
+
+	// A check naming no provider keeps the one stored.
+	order = orderByNumber(t, p, order.Number)
+	accrual := 100.0
+	if _, err = p.ApplyAccrualCheck(domain.AccrualCheck{Order: *order, Status: "PROCESSED", Accrual: &accrual}); err != nil {
+		t.Fatal(err)
+	}
+	if got := orderByNumber(t, p, order.Number).AccrualProvider; got != "partner" {
+		t.Fatalf("accrual provider = %q, want %q", got, "partner")
+	}
+}
+
+func TestApplyAccrualCheckKeepsFinalStatus(t *testing.T) {
+	p := newTestPostgres(t)
+	order := createOrder(t, p, "user", "12345678903")
+
+	if _, err := p.ApplyAccrualCheck(domain.AccrualCheck{Order: *order, Status: "INVALID"}); err != nil {
+		t.Fatal(err)
+	}
+
+	order = orderByNumber(t, p, order.Number)
+	accrual := 100.0
+	applied, err := p.ApplyAccrualCheck(domain.AccrualCheck{Order: *order, Status: "PROCESSED", Accrual: &accrual})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied {
+		t.Fatal("check applied to an invalid order")
+	}
+	if got := orderByNumber(t, p, order.Number).Status; got != "INVALID" {
+		t.Fatalf("status = %s, want INVALID", got)
+	}
+	if got := balance(t, p, order.UserID); got != 0 {
+		t.Fatalf("balance = %v, want 0", got)
+	}
+}
@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+	"time"
+)
+
+// storedGood is an element of the orders.goods column.
+type storedGood struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+// OrdersToRegister returns the orders uploaded with goods whose registration
+// with the accrual system is due. Cancelled orders aren't registered anymore.
+func (p *Postgres) OrdersToRegister(limit int) ([]domain.OrderRegistration, error) {
+	rows, err := p.DB.Query(
+		`SELECT id, number, COALESCE(store_id, ''), goods, registration_attempts
+		 FROM orders
+		 WHERE registration_status = 'PENDING' AND status = 'NEW' AND registration_next_at <= CURRENT_TIMESTAMP
+		 ORDER BY registration_next_at
+		 LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching orders to register: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error closing rows", logger.Error(err))
+		}
+	}(rows)
+
+	var registrations []domain.OrderRegistration
+	for rows.Next() {
+		var (
+			registration domain.OrderRegistration
+			goods        []byte
+		)
+		if err := rows.Scan(&registration.OrderID, &registration.Number, &registration.StoreID, &goods, &registration.Attempts); err != nil {
+			return nil, fmt.Errorf("error scanning order to register: %w", err)
+		}
+		if registration.Goods, err = decodeGoods(goods); err != nil {
+			return nil, err
+		}
+		registrations = append(registrations, registration)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over orders to register: %w", err)
+	}
+
+	return registrations, nil
+}
+
+// MarkOrderRegistered notes that the accrual system has accepted the order,
+// from now on it is polled for its accrual like any other.
+func (p *Postgres) MarkOrderRegistered(orderID int64) error {
+	_, err := p.DB.Exec(
+		`UPDATE orders
+		 SET registration_status = 'REGISTERED', registration_attempts = registration_attempts + 1,
+		     registration_next_at = NULL, registration_error = NULL
+		 WHERE id = $1`,
+		orderID,
+	)
+	if err != nil {
+		return fmt.Errorf("error marking order registered: %w", err)
+	}
+
+	return nil
+}
+
+// RetryOrderRegistration records a failed attempt and schedules the next one.
+func (p *Postgres) RetryOrderRegistration(orderID int64, reason string, delay time.Duration) error {
+	_, err := p.DB.Exec(
+		`UPDATE orders
+		 SET registration_attempts = registration_attempts + 1,
+		     registration_next_at = CURRENT_TIMESTAMP + make_interval(secs => $1),
+		     registration_error = $2
+		 WHERE id = $3`,
+		delay.Seconds(), reason, orderID,
+	)
+	if err != nil {
+		return fmt.Errorf("error rescheduling order registration: %w", err)
+	}
+
+	return nil
+}
+
+// FailOrderRegistration gives up on registering the order. It is then polled
+// like an order registered by someone else.
+func (p *Postgres) FailOrderRegistration(orderID int64, reason string) error {
+	_, err := p.DB.Exec(
+		`UPDATE orders
+		 SET registration_status = 'FAILED', registration_attempts = registration_attempts + 1,
+		     registration_next_at = NULL, registration_error = $1
+		 WHERE id = $2`,
+		reason, orderID,
+	)
+	if err != nil {
+		return fmt.Errorf("error failing order registration: %w", err)
+	}
+
+	return nil
+}
+
+func encodeGoods(goods []domain.OrderGood) (string, error) {
+	stored := make([]storedGood, len(goods))
+	for i, good := range goods {
+		stored[i] = storedGood(good)
+	}
+
+	b, err := json.Marshal(stored)
+	if err != nil {
+		return "", fmt.Errorf("error encoding goods: %w", err)
+	}
+
+	return string(b), nil
+}
+
+func decodeGoods(b []byte) ([]domain.OrderGood, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	var stored []storedGood
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, fmt.Errorf("error decoding goods: %w", err)
+	}
+
+	goods := make([]domain.OrderGood, len(stored))
+	for i, good := range stored {
+		goods[i] = domain.OrderGood(good)
+	}
+
+	return goods, nil
+}
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+	"time"
+)
+
+func (p *Postgres) OrderStatusCounts() (map[string]int64, error) {
+	rows, err := p.DB.Query("SELECT status, COUNT(*) FROM orders GROUP BY status")
+	if err != nil {
+		return nil, fmt.Errorf("error counting orders: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error closing rows", logger.Error(err))
+		}
+	}(rows)
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var (
+			status string
+			count  int64
+		)
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("error scanning order count: %w", err)
+		}
+		counts[status] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over order counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+func (p *Postgres) CountStuckOrders(age time.Duration) (int64, error) {
+	var count int64
+	err := p.DB.QueryRow(
+		"SELECT COUNT(*) FROM orders WHERE status IN ('NEW', 'PROCESSING') AND uploaded_at < CURRENT_TIMESTAMP - make_interval(secs => $1)",
+		age.Seconds(),
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting stuck orders: %w", err)
+	}
+
+	return count, nil
+}
+
+// StuckOrders returns the oldest orders that have been waiting for the
+// accrual system for longer than age.
+func (p *Postgres) StuckOrders(age time.Duration, limit int) ([]domain.Order, error) {
+	rows, err := p.DB.Query(
+		`SELECT id, number, user_id, status, accrual, uploaded_at FROM orders
+		 WHERE status IN ('NEW', 'PROCESSING') AND uploaded_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+		 ORDER BY uploaded_at LIMIT $2`,
+		age.Seconds(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching stuck orders: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error closing rows", logger.Error(err))
+		}
+	}(rows)
+
+	var orders []domain.Order
+	for rows.Next() {
+		var order domain.Order
+		err := rows.Scan(&order.ID, &order.Number, &order.UserID, &order.Status, &order.Accrual, &order.UploadedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over orders: %w", err)
+	}
+
+	return orders, nil
+}
@@ -32,7 +32,7 @@ func (p *Postgres) CreateUser(login, hashedPassword string) (int64, error) {
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
-			logger.Log.Warn("user already exists", logger.String("login", login))
+			logger.Log.Warn("user already exists")
 			return 0, domain.ErrUserExists
 		}
 		return 0, fmt.Errorf("error creating user: %w", err)
@@ -42,21 +42,68 @@ func (p *Postgres) CreateUser(login, hashedPassword string) (int64, error) {
 }
 
 func (p *Postgres) User(login string) (*domain.User, error) {
-	row := p.DB.QueryRow("SELECT id, login, password, registered_at FROM users WHERE login = $1", login)
+	row := p.DB.QueryRow("SELECT id, login, password, totp_enabled, "+userRolesColumn+", status, registered_at FROM users WHERE login = $1 AND deleted_at IS NULL", login)
 
-	var user domain.User
-	err := row.Scan(&user.ID, &user.Login, &user.Password, &user.RegisteredAt)
+	var (
+		user  domain.User
+		roles string
+	)
+	err := row.Scan(&user.ID, &user.Login, &user.Password, &user.TwoFactor, &roles, &user.Status, &user.RegisteredAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, domain.ErrIncorrectCredentials
 		}
 		return nil, fmt.Errorf("error fetching user: %w", err)
 	}
+	user.Roles = splitRoles(roles)
 
 	return &user, nil
 }
 
-func (p *Postgres) CreateOrder(orderNumber string, userID int64) error {
+func (p *Postgres) UserByID(userID int64) (*domain.User, error) {
+	row := p.DB.QueryRow("SELECT id, login, password, totp_enabled, "+userRolesColumn+", status, registered_at FROM users WHERE id = $1 AND deleted_at IS NULL", userID)
+
+	var (
+		user  domain.User
+		roles string
+	)
+	err := row.Scan(&user.ID, &user.Login, &user.Password, &user.TwoFactor, &roles, &user.Status, &user.RegisteredAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error fetching user: %w", err)
+	}
+	user.Roles = splitRoles(roles)
+
+	return &user, nil
+}
+
+func (p *Postgres) UserStatus(userID int64) (string, error) {
+	var status string
+	err := p.DB.QueryRow("SELECT status FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", domain.ErrUserNotFound
+		}
+		return "", fmt.Errorf("error fetching user status: %w", err)
+	}
+
+	return status, nil
+}
+
+func (p *Postgres) UpdatePasswordHash(userID int64, hashedPassword string) error {
+	_, err := p.DB.Exec("UPDATE users SET password = $1 WHERE id = $2", hashedPassword, userID)
+	if err != nil {
+		return fmt.Errorf("error updating password hash: %w", err)
+	}
+
+	return nil
+}
+
+// CreateOrder uploads an order. If register is set, the order has goods and
+// is registered with the external accrual system by the OrderRegistrar.
+func (p *Postgres) CreateOrder(orderNumber string, userID int64, metadata domain.OrderMetadata, register bool) error {
 	tx, err := p.DB.BeginTx(context.Background(), nil)
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
@@ -64,7 +111,7 @@ func (p *Postgres) CreateOrder(orderNumber string, userID int64) error {
 	defer rollback(tx)
 
 	var order domain.Order
-	err = tx.QueryRow("SELECT number, user_id FROM orders WHERE number = $1", orderNumber).
+	err = tx.QueryRow("SELECT number, user_id FROM orders WHERE number = $1 AND status <> 'CANCELLED'", orderNumber).
 		Scan(&order.Number, &order.UserID)
 
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
@@ -84,10 +131,32 @@ func (p *Postgres) CreateOrder(orderNumber string, userID int64) error {
 		return domain.ErrOrderExists
 	}
 
-	_, err = p.DB.Exec("INSERT INTO orders (number, user_id) VALUES ($1, $2)", orderNumber, userID)
+	var goods, registration *string
+	if len(metadata.Goods) > 0 {
+		encoded, err := encodeGoods(metadata.Goods)
+		if err != nil {
+			return err
+		}
+		goods = &encoded
+	}
+	if register {
+		pending := domain.OrderRegistrationPending
+		registration = &pending
+	}
+
+	var orderID int64
+	err = tx.QueryRow(
+		`INSERT INTO orders (number, user_id, store_id, purchase_amount, currency, purchased_at, goods, registration_status, registration_next_at)
+		 VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), $6, $7::jsonb, $8, CASE WHEN $8::varchar IS NOT NULL THEN CURRENT_TIMESTAMP END)
+		 RETURNING id`,
+		orderNumber, userID, metadata.StoreID, metadata.PurchaseAmount, metadata.Currency, metadata.PurchasedAt, goods, registration,
+	).Scan(&orderID)
 	if err != nil {
 		return fmt.Errorf("error creating order: %w", err)
 	}
+	if err = insertOrderStatusChange(tx, orderID, "NEW", nil, nil); err != nil {
+		return err
+	}
 	err = tx.Commit()
 	if err != nil {
 		return fmt.Errorf("error committing transaction: %w", err)
@@ -97,7 +166,7 @@ func (p *Postgres) CreateOrder(orderNumber string, userID int64) error {
 }
 
 func (p *Postgres) Orders(userID int64) ([]domain.Order, error) {
-	rows, err := p.DB.Query("SELECT number, user_id, status, accrual, uploaded_at FROM orders WHERE user_id = $1", userID)
+	rows, err := p.DB.Query("SELECT "+orderColumns+" FROM orders WHERE user_id = $1 ORDER BY uploaded_at DESC, id DESC", userID)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching orders: %w", err)
 	}
@@ -111,7 +180,7 @@ func (p *Postgres) Orders(userID int64) ([]domain.Order, error) {
 	var orders []domain.Order
 	for rows.Next() {
 		var order domain.Order
-		err := rows.Scan(&order.Number, &order.UserID, &order.Status, &order.Accrual, &order.UploadedAt)
+		err := rows.Scan(orderFields(&order)...)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning order: %w", err)
 		}
@@ -125,8 +194,20 @@ func (p *Postgres) Orders(userID int64) ([]domain.Order, error) {
 	return orders, nil
 }
 
+// Order returns an order of the user, domain.ErrOrderNotFound if there is no
+// such order or it belongs to someone else. If the user has cancelled the
+// number before, the live order is preferred over the latest tombstone.
+func (p *Postgres) Order(userID int64, number string) (*domain.Order, error) {
+	return scanOrderDetails(p.DB.QueryRow(
+		"SELECT "+orderDetailsColumns+" FROM orders WHERE number = $1 AND user_id = $2 ORDER BY status = 'CANCELLED', id DESC LIMIT 1",
+		number, userID,
+	))
+}
+
+// FetchPendingOrders returns the orders waiting for their accrual along with
+// the metadata and goods the accrual source may need.
 func (p *Postgres) FetchPendingOrders() ([]domain.Order, error) {
-	rows, err := p.DB.Query("SELECT id, number, user_id, status FROM orders WHERE status = 'NEW' OR status = 'PROCESSING'")
+	rows, err := p.DB.Query("SELECT " + orderDetailsColumns + " FROM orders WHERE status IN ('NEW', 'PROCESSING') AND registration_status IS DISTINCT FROM 'PENDING'")
 	if err != nil {
 		return nil, fmt.Errorf("error fetching orders: %w", err)
 	}
@@ -139,12 +220,11 @@ func (p *Postgres) FetchPendingOrders() ([]domain.Order, error) {
 
 	var orders []domain.Order
 	for rows.Next() {
-		var order domain.Order
-		err := rows.Scan(&order.ID, &order.Number, &order.UserID, &order.Status)
+		order, err := scanOrderDetails(rows)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning order: %w", err)
+			return nil, err
 		}
-		orders = append(orders, order)
+		orders = append(orders, *order)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -154,22 +234,11 @@ func (p *Postgres) FetchPendingOrders() ([]domain.Order, error) {
 	return orders, nil
 }
 
-func (p *Postgres) UpdateOrderStatus(orderID int64, status string, accrual *float64) error {
-	_, err := p.DB.Exec("UPDATE orders SET status = $1, accrual = $2 WHERE id = $3", status, accrual, orderID)
+// RecordOrderCheck notes an accrual check that didn't change the order.
+func (p *Postgres) RecordOrderCheck(orderID int64) error {
+	_, err := p.DB.Exec("UPDATE orders SET last_checked_at = CURRENT_TIMESTAMP, check_count = check_count + 1 WHERE id = $1 AND status <> 'CANCELLED'", orderID)
 	if err != nil {
-		return fmt.Errorf("error updating order status: %w", err)
-	}
-
-	return nil
-}
-
-func (p *Postgres) UpdateUserBalance(userID int64, amount *float64) error {
-	if amount == nil {
-		return nil
-	}
-	_, err := p.DB.Exec("UPDATE users SET balance = balance + $1 WHERE id = $2", *amount, userID)
-	if err != nil {
-		return fmt.Errorf("error updating user balance: %w", err)
+		return fmt.Errorf("error recording order check: %w", err)
 	}
 
 	return nil
@@ -188,7 +257,7 @@ func (p *Postgres) Balance(userID int64) (*domain.Balance, error) {
 }
 
 func (p *Postgres) Withdrawals(userID int64) ([]domain.Withdrawal, error) {
-	rows, err := p.DB.Query("SELECT order_number, amount, processed_at FROM withdrawals WHERE user_id = $1", userID)
+	rows, err := p.DB.Query("SELECT id, user_id, order_number, amount, processed_at FROM withdrawals WHERE user_id = $1 ORDER BY processed_at DESC, id DESC", userID)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching withdrawals: %w", err)
 	}
@@ -202,7 +271,7 @@ func (p *Postgres) Withdrawals(userID int64) ([]domain.Withdrawal, error) {
 	var withdrawals []domain.Withdrawal
 	for rows.Next() {
 		var withdrawal domain.Withdrawal
-		err := rows.Scan(&withdrawal.OrderNumber, &withdrawal.Amount, &withdrawal.ProcessedAt)
+		err := rows.Scan(&withdrawal.ID, &withdrawal.UserID, &withdrawal.OrderNumber, &withdrawal.Amount, &withdrawal.ProcessedAt)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning withdrawal: %w", err)
 		}
@@ -274,6 +343,15 @@ func (p *Postgres) Withdraw(orderNumber string, amount float64, userID int64) er
 		return fmt.Errorf("error updating user balance for withdrawal: %w", err)
 	}
 
+	_, err = tx.Exec(
+		"INSERT INTO balance_history (user_id, kind, amount, reference) VALUES ($1, $2, $3, $4)",
+		userID, domain.BalanceChangeWithdrawal, -amount, orderNumber,
+	)
+	if err != nil {
+		logger.Log.Error("error inserting balance history for withdrawal", logger.Int64("user_id", userID), logger.Error(err))
+		return fmt.Errorf("error inserting balance history for withdrawal: %w", err)
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		logger.Log.Error("error committing transaction for withdrawal", logger.Float64("amount", amount), logger.Int64("user_id", userID), logger.Error(err))
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/koyif/gophermart/internal/domain"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newTestPostgres returns the repository on the database of
+// TEST_DATABASE_DSN, migrated and emptied. Tests needing a database are
+// skipped without one.
+func newTestPostgres(t *testing.T) *Postgres {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	url := strings.Replace(strings.Replace(dsn, "postgresql://", "pgx5://", 1), "postgres://", "pgx5://", 1)
+	m, err := migrate.New("file://../../migrations", url)
+	if err != nil {
+		t.Fatalf("error creating migration instance: %v", err)
+	}
+	if err = m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("error running migrations: %v", err)
+	}
+	_, _ = m.Close()
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("error opening database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, err = db.Exec(`DO $$
+		DECLARE t text;
+		BEGIN
+			FOR t IN SELECT tablename FROM pg_tables WHERE schemaname = current_schema() AND tablename <> 'schema_migrations' LOOP
+				EXECUTE 'TRUNCATE ' || quote_ident(t) || ' RESTART IDENTITY CASCADE';
+			END LOOP;
+		END $$`)
+	if err != nil {
+		t.Fatalf("error emptying database: %v", err)
+	}
+
+	return New(db)
+}
+
+// createOrder uploads a new order of a new user and returns it.
+func createOrder(t *testing.T, p *Postgres, login, number string) *domain.Order {
+	t.Helper()
+
+	userID, err := p.CreateUser(login, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.CreateOrder(number, userID, domain.OrderMetadata{}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	return orderByNumber(t, p, number)
+}
+
+func orderByNumber(t *testing.T, p *Postgres, number string) *domain.Order {
+	t.Helper()
+
+	order, err := p.OrderByNumber(number)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return order
+}
+
+func balance(t *testing.T, p *Postgres, userID int64) float64 {
+	t.Helper()
+
+	b, err := p.Balance(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Current
+}
@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+	"strconv"
+)
+
+const rewardRuleColumns = "id, name, COALESCE(store_id, ''), match, reward_type, reward, valid_from, valid_to, created_at, updated_at"
+
+func (p *Postgres) RewardRules() ([]domain.RewardRule, error) {
+	rows, err := p.DB.Query("SELECT " + rewardRuleColumns + " FROM reward_rules ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching reward rules: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error closing rows", logger.Error(err))
+		}
+	}(rows)
+
+	var rules []domain.RewardRule
+	for rows.Next() {
+		rule, err := scanRewardRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over reward rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+func (p *Postgres) CreateRewardRule(rule domain.RewardRule, action domain.AdminAction) (*domain.RewardRule, error) {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	created, err := scanRewardRule(tx.QueryRow(
+		`INSERT INTO reward_rules (name, store_id, match, reward_type, reward, valid_from, valid_to)
+		 VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7)
+		 RETURNING `+rewardRuleColumns,
+		rule.Name, rule.StoreID, rule.Match, rule.RewardType, rule.Reward, rule.ValidFrom, rule.ValidTo,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	action.TargetID = strconv.FormatInt(created.ID, 10)
+	if _, err = insertAdminAction(tx, action); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return created, nil
+}
+
+func (p *Postgres) UpdateRewardRule(rule domain.RewardRule, action domain.AdminAction) (*domain.RewardRule, error) {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	updated, err := scanRewardRule(tx.QueryRow(
+		`UPDATE reward_rules
+		 SET name = $1, store_id = NULLIF($2, ''), match = $3, reward_type = $4, reward = $5,
+		     valid_from = $6, valid_to = $7, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $8
+		 RETURNING `+rewardRuleColumns,
+		rule.Name, rule.StoreID, rule.Match, rule.RewardType, rule.Reward, rule.ValidFrom, rule.ValidTo, rule.ID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = insertAdminAction(tx, action); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return updated, nil
+}
+
+func (p *Postgres) DeleteRewardRule(ruleID int64, action domain.AdminAction) error {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	res, err := tx.Exec("DELETE FROM reward_rules WHERE id = $1", ruleID)
+	if err != nil {
+		return fmt.Errorf("error deleting reward rule: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting reward rule: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrRewardRuleNotFound
+	}
+
+	if _, err = insertAdminAction(tx, action); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func scanRewardRule(row rowScanner) (*domain.RewardRule, error) {
+	var rule domain.RewardRule
+	err := row.Scan(
+		&rule.ID,
+		&rule.Name,
+		&rule.StoreID,
+		&rule.Match,
+		&rule.RewardType,
+		&rule.Reward,
+		&rule.ValidFrom,
+		&rule.ValidTo,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrRewardRuleNotFound
+		}
+		return nil, fmt.Errorf("error scanning reward rule: %w", err)
+	}
+
+	return &rule, nil
+}
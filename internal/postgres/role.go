@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/koyif/gophermart/internal/domain"
+	"strings"
+)
+
+// userRolesColumn selects the comma-separated roles of the users row in scope.
+const userRolesColumn = "COALESCE((SELECT string_agg(role, ',' ORDER BY role) FROM user_roles WHERE user_id = users.id), '')"
+
+func (p *Postgres) Roles(userID int64) ([]string, error) {
+	var roles string
+	err := p.DB.QueryRow("SELECT COALESCE(string_agg(role, ',' ORDER BY role), '') FROM user_roles WHERE user_id = $1", userID).
+		Scan(&roles)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching roles: %w", err)
+	}
+
+	return splitRoles(roles), nil
+}
+
+func (p *Postgres) CountUsersWithRole(role string) (int64, error) {
+	var count int64
+	err := p.DB.QueryRow("SELECT COUNT(*) FROM user_roles WHERE role = $1", role).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting users with role: %w", err)
+	}
+
+	return count, nil
+}
+
+func (p *Postgres) CreateUserWithRole(login, hashedPassword, role string) (int64, error) {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	var id int64
+	err = tx.QueryRow("INSERT INTO users (login, password) VALUES ($1, $2) RETURNING id", login, hashedPassword).
+		Scan(&id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+			return 0, domain.ErrUserExists
+		}
+		return 0, fmt.Errorf("error creating user: %w", err)
+	}
+
+	_, err = tx.Exec("INSERT INTO user_roles (user_id, role) VALUES ($1, $2)", id, role)
+	if err != nil {
+		return 0, fmt.Errorf("error granting role: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return id, nil
+}
+
+func splitRoles(roles string) []string {
+	if roles == "" {
+		return nil
+	}
+
+	return strings.Split(roles, ",")
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+)
+
+func (p *Postgres) CreateSession(session domain.Session) error {
+	_, err := p.DB.Exec(
+		"INSERT INTO sessions (id, user_id, user_agent, ip) VALUES ($1, $2, $3, $4)",
+		session.ID, session.UserID, session.UserAgent, session.IP,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) Sessions(userID int64) ([]domain.Session, error) {
+	rows, err := p.DB.Query(
+		"SELECT id, user_id, user_agent, ip, created_at, last_seen_at FROM sessions WHERE user_id = $1 AND revoked_at IS NULL ORDER BY last_seen_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching sessions: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error closing rows", logger.Error(err))
+		}
+	}(rows)
+
+	var sessions []domain.Session
+	for rows.Next() {
+		var session domain.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// TouchSession updates the last-seen time of a live session and returns the
+// status of its user. It returns an empty status if the session doesn't exist,
+// belongs to another user or has been revoked.
+func (p *Postgres) TouchSession(sessionID string, userID int64) (string, error) {
+	var status string
+	err := p.DB.QueryRow(
+		`UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP
+		 FROM users
+		 WHERE sessions.id = $1 AND sessions.user_id = $2 AND sessions.revoked_at IS NULL AND users.id = sessions.user_id
+		 RETURNING users.status`,
+		sessionID, userID,
+	).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("error touching session: %w", err)
+	}
+
+	return status, nil
+}
+
+func (p *Postgres) RevokeSession(userID int64, sessionID string) error {
+	res, err := p.DB.Exec(
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		sessionID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (p *Postgres) RevokeSessions(userID int64) error {
+	_, err := p.DB.Exec("UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	if err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+
+	return nil
+}
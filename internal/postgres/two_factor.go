@@ -0,0 +1,224 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"time"
+)
+
+func (p *Postgres) TwoFactor(userID int64) (*domain.TwoFactor, error) {
+	var (
+		tf     domain.TwoFactor
+		secret sql.NullString
+	)
+	err := p.DB.QueryRow(
+		"SELECT totp_secret, totp_enabled, totp_last_step, COALESCE(totp_locked_until > CURRENT_TIMESTAMP, FALSE) FROM users WHERE id = $1",
+		userID,
+	).Scan(&secret, &tf.Enabled, &tf.LastStep, &tf.Locked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error fetching two-factor settings: %w", err)
+	}
+	tf.Secret = secret.String
+
+	return &tf, nil
+}
+
+// SetPendingTOTPSecret stores a secret that becomes active once confirmed with
+// a valid code. It fails if two-factor authentication is already enabled.
+func (p *Postgres) SetPendingTOTPSecret(userID int64, secret string) error {
+	res, err := p.DB.Exec("UPDATE users SET totp_secret = $1 WHERE id = $2 AND NOT totp_enabled", secret, userID)
+	if err != nil {
+		return fmt.Errorf("error storing TOTP secret: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error storing TOTP secret: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrTwoFactorAlreadyEnabled
+	}
+
+	return nil
+}
+
+func (p *Postgres) EnableTwoFactor(userID, step int64, recoveryCodeHashes []string) error {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	res, err := tx.Exec(
+		"UPDATE users SET totp_enabled = TRUE, totp_last_step = $1 WHERE id = $2 AND NOT totp_enabled AND totp_secret IS NOT NULL",
+		step, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("error enabling two-factor authentication: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error enabling two-factor authentication: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrTwoFactorAlreadyEnabled
+	}
+
+	if err = replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) DisableTwoFactor(userID int64) error {
+	tx, err := p.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	_, err = tx.Exec("UPDATE users SET totp_secret = NULL, totp_enabled = FALSE WHERE id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("error disabling two-factor authentication: %w", err)
+	}
+
+	if err = replaceRecoveryCodes(tx, userID, nil); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep records step as the last accepted one. It reports false if a
+// code from the same or a later step has already been used.
+func (p *Postgres) UseTOTPStep(userID, step int64) (bool, error) {
+	res, err := p.DB.Exec("UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1", step, userID)
+	if err != nil {
+		return false, fmt.Errorf("error storing TOTP step: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error storing TOTP step: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+func (p *Postgres) UseRecoveryCode(userID int64, codeHash string) (bool, error) {
+	res, err := p.DB.Exec(
+		"UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, codeHash,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+func (p *Postgres) CreateTwoFactorChallenge(idHash string, userID int64, ttl time.Duration) (time.Time, error) {
+	var expiresAt time.Time
+	err := p.DB.QueryRow(
+		"INSERT INTO two_factor_challenges (id, user_id, expires_at) VALUES ($1, $2, CURRENT_TIMESTAMP + make_interval(secs => $3)) RETURNING expires_at",
+		idHash, userID, ttl.Seconds(),
+	).Scan(&expiresAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error creating two-factor challenge: %w", err)
+	}
+
+	return expiresAt, nil
+}
+
+// AttemptTwoFactorChallenge counts an attempt against a live challenge and
+// returns the user it was issued for along with the attempts made so far.
+func (p *Postgres) AttemptTwoFactorChallenge(idHash string, maxAttempts int) (int64, int, error) {
+	var (
+		userID   int64
+		attempts int
+	)
+	err := p.DB.QueryRow(
+		"UPDATE two_factor_challenges SET attempts = attempts + 1 WHERE id = $1 AND expires_at > CURRENT_TIMESTAMP AND attempts < $2 RETURNING user_id, attempts",
+		idHash, maxAttempts,
+	).Scan(&userID, &attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, 0, domain.ErrInvalidChallenge
+		}
+		return 0, 0, fmt.Errorf("error fetching two-factor challenge: %w", err)
+	}
+
+	return userID, attempts, nil
+}
+
+// RecordTwoFactorFailure counts an invalid code of the user. The maxFailures
+// one in a row locks the codes of the user for lockout and starts counting
+// again. It reports whether the user is locked now.
+func (p *Postgres) RecordTwoFactorFailure(userID int64, maxFailures int, lockout time.Duration) (bool, error) {
+	var locked bool
+	err := p.DB.QueryRow(
+		`UPDATE users
+		 SET totp_failed_attempts = CASE WHEN totp_failed_attempts + 1 >= $2 THEN 0 ELSE totp_failed_attempts + 1 END,
+		     totp_locked_until    = CASE WHEN totp_failed_attempts + 1 >= $2 THEN CURRENT_TIMESTAMP + make_interval(secs => $3) ELSE totp_locked_until END
+		 WHERE id = $1
+		 RETURNING COALESCE(totp_locked_until > CURRENT_TIMESTAMP, FALSE)`,
+		userID, maxFailures, lockout.Seconds(),
+	).Scan(&locked)
+	if err != nil {
+		return false, fmt.Errorf("error recording two-factor failure: %w", err)
+	}
+
+	return locked, nil
+}
+
+func (p *Postgres) ResetTwoFactorFailures(userID int64) error {
+	_, err := p.DB.Exec("UPDATE users SET totp_failed_attempts = 0 WHERE id = $1 AND totp_failed_attempts > 0", userID)
+	if err != nil {
+		return fmt.Errorf("error resetting two-factor failures: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) DeleteTwoFactorChallenge(idHash string) error {
+	_, err := p.DB.Exec("DELETE FROM two_factor_challenges WHERE id = $1 OR expires_at < CURRENT_TIMESTAMP", idHash)
+	if err != nil {
+		return fmt.Errorf("error deleting two-factor challenge: %w", err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int64, codeHashes []string) error {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash); err != nil {
+			return fmt.Errorf("error inserting recovery code: %w", err)
+		}
+	}
+
+	return nil
+}
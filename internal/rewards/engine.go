@@ -0,0 +1,141 @@
+// Package rewards is the built-in alternative to the external accrual system.
+// It computes the accrual of an order from the goods it has been uploaded with
+// and the reward rules managed through the admin API.
+package rewards
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/koyif/gophermart/internal/domain"
+	"math"
+	"strings"
+	"time"
+)
+
+type ruleSource interface {
+	RewardRules() ([]domain.RewardRule, error)
+}
+
+// response is recorded in the status history of the order the same way as
+// the answer of the external accrual system.
+type response struct {
+	Order   string   `json:"order"`
+	Status  string   `json:"status"`
+	Accrual *float64 `json:"accrual,omitempty"`
+	Rules   []int64  `json:"rules,omitempty"`
+}
+
+type Engine struct {
+	rules ruleSource
+}
+
+func New(rules ruleSource) *Engine {
+	return &Engine{
+		rules: rules,
+	}
+}
+
+// Reward returns the points earned by the order and the IDs of the rules that
+// have been applied. Every good is rewarded by the most generous rule that
+// matches it: the rule has to be for the store of the order or any store, its
+// Match has to occur in the description of the good, case-insensitively, and
+// the order has to be purchased, or uploaded if the purchase date is unknown,
+// within its date window.
+func (e *Engine) Reward(order domain.Order) (float64, []int64, error) {
+	rules, err := e.rules.RewardRules()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	at := order.UploadedAt
+	if order.Metadata.PurchasedAt != nil {
+		at = *order.Metadata.PurchasedAt
+	}
+
+	var applicable []domain.RewardRule
+	for _, rule := range rules {
+		if rule.StoreID != "" && rule.StoreID != order.Metadata.StoreID {
+			continue
+		}
+		if !inWindow(rule, at) {
+			continue
+		}
+		applicable = append(applicable, rule)
+	}
+
+	var (
+		total   float64
+		applied []int64
+		seen    = make(map[int64]bool)
+	)
+	for _, good := range order.Metadata.Goods {
+		description := strings.ToLower(good.Description)
+
+		var (
+			best   float64
+			bestID int64
+		)
+		for _, rule := range applicable {
+			if !strings.Contains(description, strings.ToLower(rule.Match)) {
+				continue
+			}
+			if reward := rewardFor(rule, good); reward > best {
+				best, bestID = reward, rule.ID
+			}
+		}
+
+		if bestID != 0 {
+			total += best
+			if !seen[bestID] {
+				seen[bestID] = true
+				applied = append(applied, bestID)
+			}
+		}
+	}
+
+	return math.Round(total*100) / 100, applied, nil
+}
+
+// Check processes the order at once, it implements the same interface as the
+// client of the external accrual system.
+func (e *Engine) Check(_ context.Context, order domain.Order) (domain.AccrualCheck, int, error) {
+	reward, applied, err := e.Reward(order)
+	if err != nil {
+		return domain.AccrualCheck{}, 0, err
+	}
+
+	resp := response{Order: order.Number, Status: "PROCESSED", Rules: applied}
+	if reward > 0 {
+		resp.Accrual = &reward
+	}
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return domain.AccrualCheck{}, 0, err
+	}
+
+	return domain.AccrualCheck{
+		Order:    order,
+		Status:   resp.Status,
+		Accrual:  resp.Accrual,
+		Response: string(raw),
+	}, 0, nil
+}
+
+func inWindow(rule domain.RewardRule, at time.Time) bool {
+	if rule.ValidFrom != nil && at.Before(*rule.ValidFrom) {
+		return false
+	}
+	if rule.ValidTo != nil && !at.Before(*rule.ValidTo) {
+		return false
+	}
+
+	return true
+}
+
+func rewardFor(rule domain.RewardRule, good domain.OrderGood) float64 {
+	if rule.RewardType == domain.RewardPercent {
+		return good.Price * rule.Reward / 100
+	}
+
+	return rule.Reward
+}
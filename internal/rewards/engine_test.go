@@ -0,0 +1,137 @@
+package rewards
+
+import (
+	"context"
+	"errors"
+	"github.com/koyif/gophermart/internal/domain"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeRules []domain.RewardRule
+
+func (f fakeRules) RewardRules() ([]domain.RewardRule, error) {
+	return f, nil
+}
+
+type failingRules struct{}
+
+func (failingRules) RewardRules() ([]domain.RewardRule, error) {
+	return nil, errors.New("database is down")
+}
+
+func date(day int) *time.Time {
+	t := time.Date(2026, time.October, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestEngineReward(t *testing.T) {
+	rules := fakeRules{
+		{ID: 1, Match: "teapot", RewardType: domain.RewardPercent, Reward: 10},
+		{ID: 2, Match: "TEAPOT", StoreID: "acme", RewardType: domain.RewardFixed, Reward: 1000},
+		{ID: 3, Match: "mug", RewardType: domain.RewardFixed, Reward: 5},
+		{ID: 4, Match: "mug", RewardType: domain.RewardPercent, Reward: 50, ValidFrom: date(10), ValidTo: date(20)},
+	}
+	engine := New(rules)
+
+	tests := []struct {
+		name        string
+		storeID     string
+		purchasedAt *time.Time
+		uploadedAt  time.Time
+		goods       []domain.OrderGood
+		want        float64
+		wantRules   []int64
+	}{
+		{
+			name:      "percent reward, case-insensitive",
+			goods:     []domain.OrderGood{{Description: "Bork Teapot", Price: 7000}},
+			want:      700,
+			wantRules: []int64{1},
+		},
+		{
+			name:      "most generous rule of the store",
+			storeID:   "acme",
+			goods:     []domain.OrderGood{{Description: "Bork Teapot", Price: 7000}},
+			want:      1000,
+			wantRules: []int64{2},
+		},
+		{
+			name:        "rule within its window",
+			purchasedAt: date(15),
+			goods:       []domain.OrderGood{{Description: "Mug", Price: 30}},
+			want:        15,
+			wantRules:   []int64{4},
+		},
+		{
+			name:        "window end is exclusive",
+			purchasedAt: date(20),
+			goods:       []domain.OrderGood{{Description: "Mug", Price: 30}},
+			want:        5,
+			wantRules:   []int64{3},
+		},
+		{
+			name:       "upload date without purchase date",
+			uploadedAt: *date(12),
+			goods:      []domain.OrderGood{{Description: "Mug", Price: 30}},
+			want:       15,
+			wantRules:  []int64{4},
+		},
+		{
+			name:      "rewards add up per good, rules are listed once",
+			goods:     []domain.OrderGood{{Description: "Mug", Price: 3}, {Description: "Mug", Price: 4}, {Description: "Teapot", Price: 0.15}},
+			want:      10.02,
+			wantRules: []int64{3, 1},
+		},
+		{
+			name:  "no matching rule",
+			goods: []domain.OrderGood{{Description: "Spoon", Price: 10}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := domain.Order{
+				Number:     "12345678903",
+				UploadedAt: tt.uploadedAt,
+				Metadata:   domain.OrderMetadata{StoreID: tt.storeID, PurchasedAt: tt.purchasedAt, Goods: tt.goods},
+			}
+
+			got, applied, err := engine.Reward(order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || !reflect.DeepEqual(applied, tt.wantRules) {
+				t.Fatalf("Reward() = %v, %v, want %v, %v", got, applied, tt.want, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestEngineCheck(t *testing.T) {
+	engine := New(fakeRules{{ID: 1, Match: "teapot", RewardType: domain.RewardFixed, Reward: 100}})
+
+	check, retryAfter, err := engine.Check(context.Background(), domain.Order{
+		Number:   "12345678903",
+		Metadata: domain.OrderMetadata{Goods: []domain.OrderGood{{Description: "Teapot", Price: 7000}}},
+	})
+	if err != nil || retryAfter != 0 {
+		t.Fatalf("Check() = %d, %v, want no error", retryAfter, err)
+	}
+	if check.Status != "PROCESSED" || check.Accrual == nil || *check.Accrual != 100 {
+		t.Fatalf("Check() = %+v, want PROCESSED with 100", check)
+	}
+	if check.Response != `{"order":"12345678903","status":"PROCESSED","accrual":100,"rules":[1]}` {
+		t.Fatalf("response = %s", check.Response)
+	}
+
+	// An order without reward is processed without accrual.
+	check, _, err = engine.Check(context.Background(), domain.Order{Number: "79927398713"})
+	if err != nil || check.Status != "PROCESSED" || check.Accrual != nil {
+		t.Fatalf("Check() without goods = %+v, %v, want PROCESSED without accrual", check, err)
+	}
+
+	if _, _, err = New(failingRules{}).Check(context.Background(), domain.Order{Number: "12345678903"}); err == nil {
+		t.Fatal("Check() hid the error of the rules")
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/password"
+	"github.com/koyif/gophermart/pkg/logger"
+)
+
+type accountRepository interface {
+	UserByID(userID int64) (*domain.User, error)
+	Balance(userID int64) (*domain.Balance, error)
+	Orders(userID int64) ([]domain.Order, error)
+	Withdrawals(userID int64) ([]domain.Withdrawal, error)
+	BalanceHistory(userID int64) ([]domain.BalanceChange, error)
+	Sessions(userID int64) ([]domain.Session, error)
+	DeleteUser(userID int64) error
+}
+
+type twoFactorVerifier interface {
+	Verify(userID int64, code string) error
+}
+
+type sessionRevoker interface {
+	RevokeAll(userID int64) error
+}
+
+type AccountService struct {
+	repo      accountRepository
+	hasher    password.Hasher
+	twoFactor twoFactorVerifier
+	sessions  sessionRevoker
+}
+
+func NewAccountService(
+	repo accountRepository,
+	hasher password.Hasher,
+	twoFactor twoFactorVerifier,
+	sessions sessionRevoker,
+) *AccountService {
+	return &AccountService{
+		repo:      repo,
+		hasher:    hasher,
+		twoFactor: twoFactor,
+		sessions:  sessions,
+	}
+}
+
+// Export collects everything stored about the user.
+func (s *AccountService) Export(userID int64) (*domain.AccountExport, error) {
+	user, err := s.repo.UserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := s.repo.Balance(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := s.repo.Orders(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	withdrawals, err := s.repo.Withdrawals(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.BalanceHistory(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.repo.Sessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.AccountExport{
+		User:           *user,
+		Balance:        *balance,
+		Orders:         orders,
+		Withdrawals:    withdrawals,
+		BalanceHistory: history,
+		Sessions:       sessions,
+	}, nil
+}
+
+// Delete anonymizes the account after checking the password and, if enabled,
+// a two-factor code. Financial records are kept for accounting.
+func (s *AccountService) Delete(userID int64, currentPassword, code string) error {
+	user, err := s.repo.UserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	match, _, err := s.hasher.Verify(user.Password, currentPassword)
+	if err != nil {
+		return err
+	}
+	if !match {
+		logger.Log.Warn("incorrect password for account deletion", logger.Int64("user_id", userID))
+		return domain.ErrIncorrectCredentials
+	}
+
+	if user.TwoFactor {
+		if code == "" {
+			return domain.ErrTwoFactorRequired
+		}
+		if err = s.twoFactor.Verify(userID, code); err != nil {
+			return err
+		}
+	}
+
+	if err = s.sessions.RevokeAll(userID); err != nil {
+		return err
+	}
+
+	if err = s.repo.DeleteUser(userID); err != nil {
+		return err
+	}
+
+	logger.Log.Info("account deleted", logger.Int64("user_id", userID))
+
+	return nil
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/tlsclient"
+	"github.com/koyif/gophermart/pkg/dto"
+	"github.com/koyif/gophermart/pkg/logger"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultRetryAfter is the backoff in seconds when the accrual system
+	// doesn't say how long to wait.
+	defaultRetryAfter = 60
+
+	defaultAccrualTimeout = 10 * time.Second
+)
+
+// errOrderRejected is returned when the accrual system refuses to register an
+// order, retrying it won't help.
+var errOrderRejected = errors.New("order rejected by the accrual system")
+
+// AccrualLimitRepository keeps the rate limit and the backoff of the accrual
+// providers shared by all replicas, so that together they stay within the
+// limit and all of them pause when one is told to back off.
+type AccrualLimitRepository interface {
+	AcquireAccrualRequest(provider string, budget int, window time.Duration) (time.Duration, bool, error)
+	BackOffAccrual(provider string, d time.Duration) error
+}
+
+// AccrualProvider is the client of an accrual system. Every provider has its
+// own timeout, rate limit and backoff.
+type AccrualProvider struct {
+	name   string
+	url    *url.URL
+	client *http.Client
+
+	limits AccrualLimitRepository
+	budget int
+	window time.Duration
+
+	// backoffUntil is the backoff this replica knows of, it spares asking the
+	// repository until it is over.
+	backoffUntil atomic.Int64
+	requests     atomic.Int64
+	errors       atomic.Int64
+	rateLimited  atomic.Int64
+}
+
+// AccrualProviderConfig describes an accrual system. RateLimit is the number
+// of requests per second all replicas make together, 0 for no limit, Timeout
+// is defaultAccrualTimeout if 0.
+type AccrualProviderConfig struct {
+	URL       string
+	RateLimit float64
+	Timeout   time.Duration
+	TLS       tlsclient.Options
+}
+
+func NewAccrualProvider(name string, cfg AccrualProviderConfig, limits AccrualLimitRepository) (*AccrualProvider, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address of accrual provider %q: %w", name, err)
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultAccrualTimeout
+	}
+
+	tlsConfig, err := tlsclient.New(cfg.TLS, u.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration of accrual provider %q: %w", name, err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	p := &AccrualProvider{
+		name:   name,
+		url:    u,
+		client: &http.Client{Timeout: timeout, Transport: transport},
+		limits: limits,
+	}
+	// A limit below one request per second is a budget of one request per
+	// longer window.
+	switch {
+	case cfg.RateLimit >= 1:
+		p.budget, p.window = int(cfg.RateLimit), time.Second
+	case cfg.RateLimit > 0:
+		p.budget, p.window = 1, time.Duration(float64(time.Second)/cfg.RateLimit)
+	}
+
+	return p, nil
+}
+
+// Check asks the accrual system about the order. An empty status of the check
+// means the accrual system doesn't know the order.
+func (p *AccrualProvider) Check(ctx context.Context, order domain.Order) (domain.AccrualCheck, int, error) {
+	if retryAfter, err := p.acquire(ctx); err != nil || retryAfter > 0 {
+		return domain.AccrualCheck{}, retryAfter, err
+	}
+
+	accRes, raw, retryAfter, err := p.sendRequest(ctx, order.Number)
+	if err != nil || retryAfter > 0 {
+		return domain.AccrualCheck{}, retryAfter, err
+	}
+
+	check := domain.AccrualCheck{Order: order}
+	if accRes != nil {
+		check.Status = orderStatus(accRes.Status)
+		check.Accrual = accRes.Accrual
+		check.Response = string(raw)
+	}
+
+	return check, 0, nil
+}
+
+// Register registers an order with its goods in the accrual system. An order
+// the accrual system already knows counts as registered.
+func (p *AccrualProvider) Register(ctx context.Context, number string, goods []domain.OrderGood) (int, error) {
+	if retryAfter, err := p.acquire(ctx); err != nil || retryAfter > 0 {
+		return retryAfter, err
+	}
+
+	req := dto.AccrualOrder{Order: number, Goods: make([]dto.AccrualGood, len(goods))}
+	for i, good := range goods {
+		req.Goods[i] = dto.AccrualGood{Description: good.Description, Price: good.Price}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+
+	response, err := p.do(ctx, http.MethodPost, p.url.JoinPath("api/orders").String(), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer func(body io.ReadCloser) {
+		err := body.Close()
+		if err != nil {
+			logger.Log.Error("error while closing response body", logger.Error(err))
+			return
+		}
+	}(response.Body)
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusConflict:
+		return 0, nil
+	case http.StatusTooManyRequests:
+		return p.backOff(response), nil
+	case http.StatusBadRequest:
+		p.errors.Add(1)
+		return 0, errOrderRejected
+	default:
+		p.errors.Add(1)
+		return 0, fmt.Errorf("unexpected status of accrual provider %q: %d", p.name, response.StatusCode)
+	}
+}
+
+// Stats reports what the provider has done since start.
+func (p *AccrualProvider) Stats() domain.AccrualProviderStats {
+	stats := domain.AccrualProviderStats{
+		Name:        p.name,
+		Requests:    p.requests.Load(),
+		Errors:      p.errors.Load(),
+		RateLimited: p.rateLimited.Load(),
+	}
+	if until := p.backoffUntil.Load(); until > time.Now().UnixNano() {
+		stats.BackoffUntil = time.Unix(0, until)
+	}
+
+	return stats
+}
+
+// sendRequest returns the decoded answer of the accrual system along with
+// the raw body, or the number of seconds to back off for.
+func (p *AccrualProvider) sendRequest(ctx context.Context, number string) (*dto.AccrualResponse, []byte, int, error) {
+	response, err := p.do(ctx, http.MethodGet, p.url.JoinPath("api/orders", number).String(), nil)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer func(body io.ReadCloser) {
+		err := body.Close()
+		if err != nil {
+			logger.Log.Error("error while closing response body", logger.Error(err))
+			return
+		}
+	}(response.Body)
+
+	if response.StatusCode == http.StatusTooManyRequests {
+		return nil, nil, p.backOff(response), nil
+	}
+
+	if response.StatusCode == http.StatusNoContent {
+		return nil, nil, 0, nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		p.errors.Add(1)
+		return nil, nil, 0, fmt.Errorf("unexpected status of accrual provider %q: %d", p.name, response.StatusCode)
+	}
+
+	raw, err := io.ReadAll(response.Body)
+	if err != nil {
+		p.errors.Add(1)
+		return nil, nil, 0, err
+	}
+
+	var accRes dto.AccrualResponse
+	if err = json.Unmarshal(raw, &accRes); err != nil {
+		p.errors.Add(1)
+		return nil, nil, 0, err
+	}
+
+	return &accRes, raw, 0, nil
+}
+
+func (p *AccrualProvider) do(ctx context.Context, method, target string, body io.Reader) (*http.Response, error) {
+	p.requests.Add(1)
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		p.errors.Add(1)
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := p.client.Do(req)
+	if err != nil {
+		p.errors.Add(1)
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// acquire waits until the rate limit allows a request, or until ctx is done.
+// It returns the remaining seconds of the backoff instead if the provider is
+// backing off.
+func (p *AccrualProvider) acquire(ctx context.Context) (int, error) {
+	if retryAfter := p.backingOff(); retryAfter > 0 {
+		return retryAfter, nil
+	}
+
+	for {
+		wait, backingOff, err := p.limits.AcquireAccrualRequest(p.name, p.budget, p.window)
+		if err != nil {
+			return 0, err
+		}
+		if wait <= 0 {
+			return 0, nil
+		}
+		if backingOff {
+			p.backoffUntil.Store(time.Now().Add(wait).UnixNano())
+			return p.backingOff(), nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backOff starts the backoff the 429 response asks for, for all replicas, and
+// returns its length in seconds.
+func (p *AccrualProvider) backOff(response *http.Response) int {
+	retryAfter, err := strconv.Atoi(response.Header.Get("Retry-After"))
+	if err != nil || retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+
+	d := time.Duration(retryAfter) * time.Second
+	p.rateLimited.Add(1)
+	p.backoffUntil.Store(time.Now().Add(d).UnixNano())
+	if err = p.limits.BackOffAccrual(p.name, d); err != nil {
+		logger.Log.Error("error while sharing accrual backoff", logger.String("provider", p.name), logger.Error(err))
+	}
+	logger.Log.Warn(
+		"accrual provider rate limit exceeded, backing off",
+		logger.String("provider", p.name),
+		logger.Int64("seconds", int64(retryAfter)),
+	)
+
+	return retryAfter
+}
+
+// backingOff returns the remaining seconds of the backoff, 0 if there is none.
+func (p *AccrualProvider) backingOff() int {
+	remaining := time.Until(time.Unix(0, p.backoffUntil.Load()))
+	if remaining <= 0 {
+		return 0
+	}
+
+	return int(remaining.Seconds()) + 1
+}
+
+// orderStatus maps a status of the accrual system to the one of the order. An
+// order registered by the accrual system is being processed from our side.
+func orderStatus(accrualStatus string) string {
+	if accrualStatus == "REGISTERED" {
+		return "PROCESSING"
+	}
+
+	return accrualStatus
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/koyif/gophermart/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeAccrualLimits struct {
+	mu         sync.Mutex
+	wait       time.Duration
+	backingOff bool
+	acquired   int
+	backoffs   []time.Duration
+}
+
+func (l *fakeAccrualLimits) AcquireAccrualRequest(string, int, time.Duration) (time.Duration, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.acquired++
+	return l.wait, l.backingOff, nil
+}
+
+func (l *fakeAccrualLimits) BackOffAccrual(_ string, d time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.backoffs = append(l.backoffs, d)
+	return nil
+}
+
+func TestAccrualProviderCheckStopsWaitingWhenCancelled(t *testing.T) {
+	limits := &fakeAccrualLimits{wait: time.Hour}
+	provider, err := NewAccrualProvider("partner", AccrualProviderConfig{URL: "http://accrual.invalid", RateLimit: 1}, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := provider.Check(ctx, domain.Order{Number: "12345678903"})
+		done <- err
+	}()
+	cancel()
+
+	select {
+	case err = <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Check() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Check() kept waiting for the rate limit after cancellation")
+	}
+}
+
+func TestAccrualProviderCheckBacksOff(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	limits := &fakeAccrualLimits{}
+	provider, err := NewAccrualProvider("partner", AccrualProviderConfig{URL: srv.URL}, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, retryAfter, err := provider.Check(context.Background(), domain.Order{Number: "12345678903"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retryAfter != 30 {
+		t.Fatalf("retry after = %d, want 30", retryAfter)
+	}
+	if len(limits.backoffs) != 1 || limits.backoffs[0] != 30*time.Second {
+		t.Fatalf("shared backoffs = %v, want [30s]", limits.backoffs)
+	}
+
+	// The backoff this replica knows of spares the shared limits and the
+	// accrual system.
+	if _, retryAfter, err = provider.Check(context.Background(), domain.Order{Number: "12345678903"}); err != nil || retryAfter <= 0 {
+		t.Fatalf("Check() = %d, %v, want a backoff", retryAfter, err)
+	}
+	if requests.Load() != 1 || limits.acquired != 1 {
+		t.Fatalf("requests = %d, acquired = %d, want 1 and 1", requests.Load(), limits.acquired)
+	}
+}
+
+func TestAccrualProviderCheckReturnsSharedBackoff(t *testing.T) {
+	limits := &fakeAccrualLimits{wait: 10 * time.Second, backingOff: true}
+	provider, err := NewAccrualProvider("partner", AccrualProviderConfig{URL: "http://accrual.invalid"}, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, retryAfter, err := provider.Check(context.Background(), domain.Order{Number: "12345678903"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retryAfter <= 0 || retryAfter > 11 {
+		t.Fatalf("retry after = %d, want about 10", retryAfter)
+	}
+}
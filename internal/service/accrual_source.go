@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/koyif/gophermart/internal/config"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/tlsclient"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Names of the accrual sources in the configuration.
+const (
+	AccrualSourceHTTP    = "http"
+	AccrualSourceRewards = "rewards"
+)
+
+// AccrualSource tells the accrual of an order. It returns the number of
+// seconds to back off for if the source is rate limiting.
+type AccrualSource interface {
+	Check(ctx context.Context, order domain.Order) (domain.AccrualCheck, int, error)
+}
+
+// providersFile is the format of ACCRUAL_PROVIDERS_FILE:
+//
+//	{
+//	  "default": "http",
+//	  "providers": {
+//	    "partner": {
+//	      "url": "https://accrual.partner.example",
+//	      "rate_limit": 20,
+//	      "timeout": "5s",
+//	      "tls": {"cert_file": "client.pem", "key_file": "client.key", "ca_file": "partner-ca.pem"}
+//	    }
+//	  },
+//	  "merchants": {"acme-stores": "partner", "corner-shop": "rewards"},
+//	  "prefixes": {"77": "partner"}
+//	}
+//
+// rate_limit is in requests per second of all replicas together, 0 or missing
+// for no limit, tls takes the tlsclient.Options. The http
+// provider at ACCRUAL_SYSTEM_ADDRESS and the rewards engine are always
+// defined, a provider named http in the file replaces the former.
+type providersFile struct {
+	Default   string `json:"default"`
+	Providers map[string]struct {
+		URL       string            `json:"url"`
+		RateLimit float64           `json:"rate_limit"`
+		Timeout   string            `json:"timeout"`
+		TLS       tlsclient.Options `json:"tls"`
+	} `json:"providers"`
+	Merchants map[string]string `json:"merchants"`
+	Prefixes  map[string]string `json:"prefixes"`
+}
+
+type accrualPrefix struct {
+	prefix string
+	name   string
+}
+
+// AccrualSources routes an order to its source of accrual: the source of its
+// store if it has one, otherwise the source of the longest matching number
+// prefix, otherwise the default one. ACCRUAL_SOURCE and ACCRUAL_STORE_SOURCES
+// take precedence over the default and the merchants of the providers file.
+type AccrualSources struct {
+	sources   map[string]AccrualSource
+	providers map[string]*AccrualProvider
+	fallback  string
+	merchants map[string]string
+	prefixes  []accrualPrefix
+}
+
+// NewAccrualSources builds the accrual providers of the configuration next to
+// the built-in sources, which aren't accrual systems to register orders with.
+func NewAccrualSources(cfg *config.Config, limits AccrualLimitRepository, sources map[string]AccrualSource) (*AccrualSources, error) {
+	var file providersFile
+	if cfg.AccrualProvidersFile != "" {
+		data, err := os.ReadFile(cfg.AccrualProvidersFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading accrual providers: %w", err)
+		}
+		if err = json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("error parsing accrual providers: %w", err)
+		}
+	}
+
+	httpProvider, err := NewAccrualProvider(AccrualSourceHTTP, AccrualProviderConfig{
+		URL:       cfg.AccrualSystemAddress,
+		RateLimit: cfg.AccrualRateLimit,
+		Timeout:   cfg.AccrualTimeout,
+		TLS: tlsclient.Options{
+			CertFile:   cfg.AccrualTLSCertFile,
+			KeyFile:    cfg.AccrualTLSKeyFile,
+			CAFile:     cfg.AccrualTLSCAFile,
+			ServerName: cfg.AccrualTLSServerName,
+			MinVersion: cfg.AccrualTLSMinVersion,
+		},
+	}, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &AccrualSources{
+		sources:   make(map[string]AccrualSource),
+		providers: map[string]*AccrualProvider{AccrualSourceHTTP: httpProvider},
+		fallback:  AccrualSourceHTTP,
+		merchants: make(map[string]string),
+	}
+	for name, source := range sources {
+		s.sources[name] = source
+	}
+	for name, provider := range file.Providers {
+		if _, ok := s.sources[name]; ok {
+			return nil, fmt.Errorf("accrual provider %q clashes with a built-in source", name)
+		}
+
+		var timeout time.Duration
+		if provider.Timeout != "" {
+			if timeout, err = time.ParseDuration(provider.Timeout); err != nil {
+				return nil, fmt.Errorf("accrual provider %q has invalid timeout: %w", name, err)
+			}
+		}
+		s.providers[name], err = NewAccrualProvider(name, AccrualProviderConfig{
+			URL:       provider.URL,
+			RateLimit: provider.RateLimit,
+			Timeout:   timeout,
+			TLS:       provider.TLS,
+		}, limits)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name, provider := range s.providers {
+		s.sources[name] = provider
+	}
+
+	lookup := func(name string) (string, error) {
+		if _, ok := s.sources[name]; !ok {
+			return "", fmt.Errorf("unknown accrual source %q", name)
+		}
+		return name, nil
+	}
+
+	for _, fallback := range []string{file.Default, cfg.AccrualSource} {
+		if fallback == "" {
+			continue
+		}
+		if s.fallback, err = lookup(fallback); err != nil {
+			return nil, err
+		}
+	}
+	for _, merchants := range []map[string]string{file.Merchants, cfg.AccrualStoreSources} {
+		for merchant, name := range merchants {
+			if s.merchants[merchant], err = lookup(name); err != nil {
+				return nil, fmt.Errorf("store %q: %w", merchant, err)
+			}
+		}
+	}
+	for prefix, name := range file.Prefixes {
+		if name, err = lookup(name); err != nil {
+			return nil, fmt.Errorf("prefix %q: %w", prefix, err)
+		}
+		s.prefixes = append(s.prefixes, accrualPrefix{prefix: prefix, name: name})
+	}
+	sort.Slice(s.prefixes, func(i, j int) bool {
+		return len(s.prefixes[i].prefix) > len(s.prefixes[j].prefix)
+	})
+
+	return s, nil
+}
+
+// Check asks the source of the order and names it in the answer.
+func (s *AccrualSources) Check(ctx context.Context, order domain.Order) (domain.AccrualCheck, int, error) {
+	name := s.Provider(order)
+	check, retryAfter, err := s.sources[name].Check(ctx, order)
+	check.Provider = name
+
+	return check, retryAfter, err
+}
+
+// Register registers an order with the accrual provider it is routed to. An
+// order routed to a built-in source meanwhile is rejected, it would never be
+// registered.
+func (s *AccrualSources) Register(ctx context.Context, registration domain.OrderRegistration) (int, error) {
+	name := s.route(registration.StoreID, registration.Number)
+	provider, ok := s.providers[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: accrual source %q doesn't register orders", errOrderRejected, name)
+	}
+
+	return provider.Register(ctx, registration.Number, registration.Goods)
+}
+
+// External reports whether the order is processed by an external accrual
+// system, which needs orders uploaded with goods registered.
+func (s *AccrualSources) External(storeID, number string) bool {
+	_, ok := s.providers[s.route(storeID, number)]
+	return ok
+}
+
+// Provider returns the name of the source the order is routed to.
+func (s *AccrualSources) Provider(order domain.Order) string {
+	return s.route(order.Metadata.StoreID, order.Number)
+}
+
+// Stats reports what the accrual providers have done since start.
+func (s *AccrualSources) Stats() domain.AccrualStats {
+	var stats domain.AccrualStats
+	for _, provider := range s.providers {
+		p := provider.Stats()
+		stats.Requests += p.Requests
+		stats.Errors += p.Errors
+		stats.RateLimited += p.RateLimited
+		if p.BackoffUntil.After(stats.BackoffUntil) {
+			stats.BackoffUntil = p.BackoffUntil
+		}
+		stats.Providers = append(stats.Providers, p)
+	}
+	sort.Slice(stats.Providers, func(i, j int) bool {
+		return stats.Providers[i].Name < stats.Providers[j].Name
+	})
+
+	return stats
+}
+
+func (s *AccrualSources) route(storeID, number string) string {
+	if name, ok := s.merchants[storeID]; ok && storeID != "" {
+		return name
+	}
+
+	for _, rule := range s.prefixes {
+		if strings.HasPrefix(number, rule.prefix) {
+			return rule.name
+		}
+	}
+
+	return s.fallback
+}
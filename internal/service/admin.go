@@ -0,0 +1,351 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+	"strconv"
+)
+
+const (
+	AdminActionSearchUsers   = "users.search"
+	AdminActionViewUser      = "users.view"
+	AdminActionViewOrders    = "users.orders"
+	AdminActionViewWithdraws = "users.withdrawals"
+	AdminActionViewOrder     = "orders.view"
+	AdminActionRequeueOrder  = "orders.requeue"
+	AdminActionReassignOrder = "orders.reassign"
+	AdminActionAdjustBalance = "balance.adjust"
+	AdminActionSearchAudit   = "audit.search"
+	AdminActionSetStatus     = "users.status"
+	AdminActionListRules     = "reward_rules.list"
+	AdminActionCreateRule    = "reward_rules.create"
+	AdminActionUpdateRule    = "reward_rules.update"
+	AdminActionDeleteRule    = "reward_rules.delete"
+
+	adminTargetUser  = "user"
+	adminTargetOrder = "order"
+	adminTargetRule  = "reward_rule"
+)
+
+type adminRepository interface {
+	SearchUsers(login string, limit, offset int) ([]domain.UserSummary, error)
+	UserSummary(userID int64) (*domain.UserSummary, error)
+	Orders(userID int64) ([]domain.Order, error)
+	Withdrawals(userID int64) ([]domain.Withdrawal, error)
+	RequeueOrder(number string, action domain.AdminAction) error
+	ReassignOrder(number string, userID int64, action domain.AdminAction) error
+	AdjustBalance(userID int64, amount float64, action domain.AdminAction) (*domain.Balance, error)
+	RecordAdminAction(action domain.AdminAction) error
+	AuditEvents(filter domain.AuditFilter) ([]domain.AuditEvent, error)
+	SetUserStatus(userID int64, status string, action domain.AdminAction) error
+	OrderByNumber(number string) (*domain.Order, error)
+	OrderHistory(orderID int64) ([]domain.OrderStatusChange, error)
+	RewardRules() ([]domain.RewardRule, error)
+	CreateRewardRule(rule domain.RewardRule, action domain.AdminAction) (*domain.RewardRule, error)
+	UpdateRewardRule(rule domain.RewardRule, action domain.AdminAction) (*domain.RewardRule, error)
+	DeleteRewardRule(ruleID int64, action domain.AdminAction) error
+}
+
+type accountSessions interface {
+	RevokeAll(userID int64) error
+	Forget(userID int64)
+}
+
+// AdminService backs the support operations of the admin API. Every call is
+// recorded in admin_actions with the identity of the admin who made it,
+// mutations are recorded in the same transaction as the change. Balance
+// adjustments are money events and also go to the audit log.
+type AdminService struct {
+	repo     adminRepository
+	sessions accountSessions
+	audit    auditRecorder
+}
+
+func NewAdminService(repo adminRepository, sessions accountSessions, audit auditRecorder) *AdminService {
+	return &AdminService{
+		repo:     repo,
+		sessions: sessions,
+		audit:    audit,
+	}
+}
+
+func (s *AdminService) SearchUsers(adminID int64, login string, limit, offset int) ([]domain.UserSummary, error) {
+	s.record(domain.AdminAction{
+		AdminID: adminID,
+		Action:  AdminActionSearchUsers,
+		Details: details(map[string]any{"login": login, "limit": limit, "offset": offset}),
+	})
+
+	return s.repo.SearchUsers(login, limit, offset)
+}
+
+func (s *AdminService) User(adminID, userID int64) (*domain.UserSummary, error) {
+	s.record(userAction(adminID, AdminActionViewUser, userID))
+
+	return s.repo.UserSummary(userID)
+}
+
+func (s *AdminService) Orders(adminID, userID int64) ([]domain.Order, error) {
+	s.record(userAction(adminID, AdminActionViewOrders, userID))
+
+	return s.repo.Orders(userID)
+}
+
+func (s *AdminService) Withdrawals(adminID, userID int64) ([]domain.Withdrawal, error) {
+	s.record(userAction(adminID, AdminActionViewWithdraws, userID))
+
+	return s.repo.Withdrawals(userID)
+}
+
+// Order returns any order with its status history.
+func (s *AdminService) Order(adminID int64, number string) (*domain.OrderDetails, error) {
+	s.record(domain.AdminAction{
+		AdminID:    adminID,
+		Action:     AdminActionViewOrder,
+		TargetType: adminTargetOrder,
+		TargetID:   number,
+	})
+
+	order, err := s.repo.OrderByNumber(number)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.OrderHistory(order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.OrderDetails{Order: *order, History: history}, nil
+}
+
+func (s *AdminService) RequeueOrder(adminID int64, number, reason string) error {
+	err := s.repo.RequeueOrder(number, domain.AdminAction{
+		AdminID:    adminID,
+		Action:     AdminActionRequeueOrder,
+		TargetType: adminTargetOrder,
+		TargetID:   number,
+		Reason:     reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Log.Info("order requeued by admin", logger.Int64("admin_id", adminID), logger.String("number", number))
+
+	return nil
+}
+
+// ReassignOrder gives an order that hasn't been credited yet to another user,
+// e.g. to its real owner after someone else has uploaded the number.
+func (s *AdminService) ReassignOrder(adminID int64, number string, userID int64, reason string) error {
+	err := s.repo.ReassignOrder(number, userID, domain.AdminAction{
+		AdminID:    adminID,
+		Action:     AdminActionReassignOrder,
+		TargetType: adminTargetOrder,
+		TargetID:   number,
+		Reason:     reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Log.Info(
+		"order reassigned by admin",
+		logger.Int64("admin_id", adminID),
+		logger.String("number", number),
+		logger.Int64("user_id", userID),
+	)
+
+	return nil
+}
+
+// SetUserStatus suspends, closes or reactivates an account. Closing it signs
+// the user out everywhere.
+func (s *AdminService) SetUserStatus(adminID, userID int64, status, reason string) error {
+	action := userAction(adminID, AdminActionSetStatus, userID)
+	action.Reason = reason
+	action.Details = details(map[string]any{"status": status})
+
+	if err := s.repo.SetUserStatus(userID, status, action); err != nil {
+		return err
+	}
+
+	if status == domain.UserStatusClosed {
+		if err := s.sessions.RevokeAll(userID); err != nil {
+			return err
+		}
+	} else {
+		s.sessions.Forget(userID)
+	}
+
+	logger.Log.Info(
+		"user status changed by admin",
+		logger.Int64("admin_id", adminID),
+		logger.Int64("user_id", userID),
+		logger.String("status", status),
+	)
+
+	return nil
+}
+
+func (s *AdminService) AdjustBalance(adminID, userID int64, amount float64, reason string, client domain.ClientInfo) (*domain.Balance, error) {
+	action := userAction(adminID, AdminActionAdjustBalance, userID)
+	action.Reason = reason
+	action.Details = details(map[string]any{"amount": amount})
+
+	event := domain.AuditEvent{
+		ActorID:    &adminID,
+		IP:         client.IP,
+		Type:       AuditEventAdjustment,
+		TargetType: auditTargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+		Outcome:    domain.AuditOutcomeSuccess,
+		Details:    details(map[string]any{"amount": amount, "reason": reason}),
+	}
+
+	balance, err := s.repo.AdjustBalance(userID, amount, action)
+	if err != nil {
+		s.audit.Record(auditFailure(event, err))
+		return nil, err
+	}
+	s.audit.Record(event)
+
+	logger.Log.Info(
+		"balance adjusted by admin",
+		logger.Int64("admin_id", adminID),
+		logger.Int64("user_id", userID),
+		logger.Float64("amount", amount),
+	)
+
+	return balance, nil
+}
+
+func (s *AdminService) AuditEvents(adminID int64, filter domain.AuditFilter) ([]domain.AuditEvent, error) {
+	query := map[string]any{
+		"type":        filter.Type,
+		"target_type": filter.TargetType,
+		"target_id":   filter.TargetID,
+		"outcome":     filter.Outcome,
+		"limit":       filter.Limit,
+		"offset":      filter.Offset,
+	}
+	if filter.ActorID != nil {
+		query["actor_id"] = *filter.ActorID
+	}
+	if !filter.From.IsZero() {
+		query["from"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		query["to"] = filter.To
+	}
+	s.record(domain.AdminAction{
+		AdminID: adminID,
+		Action:  AdminActionSearchAudit,
+		Details: details(query),
+	})
+
+	return s.repo.AuditEvents(filter)
+}
+
+// RewardRules returns the rules of the built-in rewards engine.
+func (s *AdminService) RewardRules(adminID int64) ([]domain.RewardRule, error) {
+	s.record(domain.AdminAction{
+		AdminID: adminID,
+		Action:  AdminActionListRules,
+	})
+
+	return s.repo.RewardRules()
+}
+
+func (s *AdminService) CreateRewardRule(adminID int64, rule domain.RewardRule) (*domain.RewardRule, error) {
+	created, err := s.repo.CreateRewardRule(rule, ruleAction(adminID, AdminActionCreateRule, rule))
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log.Info("reward rule created by admin", logger.Int64("admin_id", adminID), logger.Int64("rule_id", created.ID))
+
+	return created, nil
+}
+
+func (s *AdminService) UpdateRewardRule(adminID int64, rule domain.RewardRule) (*domain.RewardRule, error) {
+	updated, err := s.repo.UpdateRewardRule(rule, ruleAction(adminID, AdminActionUpdateRule, rule))
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log.Info("reward rule updated by admin", logger.Int64("admin_id", adminID), logger.Int64("rule_id", rule.ID))
+
+	return updated, nil
+}
+
+func (s *AdminService) DeleteRewardRule(adminID, ruleID int64) error {
+	err := s.repo.DeleteRewardRule(ruleID, domain.AdminAction{
+		AdminID:    adminID,
+		Action:     AdminActionDeleteRule,
+		TargetType: adminTargetRule,
+		TargetID:   strconv.FormatInt(ruleID, 10),
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Log.Info("reward rule deleted by admin", logger.Int64("admin_id", adminID), logger.Int64("rule_id", ruleID))
+
+	return nil
+}
+
+// record stores a read-only action. A failure is logged but doesn't prevent
+// the admin from getting the data.
+func (s *AdminService) record(action domain.AdminAction) {
+	if err := s.repo.RecordAdminAction(action); err != nil {
+		logger.Log.Error("error while recording admin action", logger.String("action", action.Action), logger.Error(err))
+	}
+}
+
+func userAction(adminID int64, action string, userID int64) domain.AdminAction {
+	return domain.AdminAction{
+		AdminID:    adminID,
+		Action:     action,
+		TargetType: adminTargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+	}
+}
+
+// ruleAction records the rule as it is being saved, the ID of a new rule is
+// filled in by the repository.
+func ruleAction(adminID int64, action string, rule domain.RewardRule) domain.AdminAction {
+	ruleDetails := map[string]any{
+		"name":        rule.Name,
+		"store_id":    rule.StoreID,
+		"match":       rule.Match,
+		"reward_type": rule.RewardType,
+		"reward":      rule.Reward,
+	}
+	if rule.ValidFrom != nil {
+		ruleDetails["valid_from"] = rule.ValidFrom
+	}
+	if rule.ValidTo != nil {
+		ruleDetails["valid_to"] = rule.ValidTo
+	}
+
+	return domain.AdminAction{
+		AdminID:    adminID,
+		Action:     action,
+		TargetType: adminTargetRule,
+		TargetID:   strconv.FormatInt(rule.ID, 10),
+		Details:    details(ruleDetails),
+	}
+}
+
+func details(v map[string]any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf(`{"error": %q}`, err.Error())
+	}
+
+	return string(b)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"errors"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+	"strconv"
+)
+
+const (
+	AuditEventRegister       = "user.register"
+	AuditEventLogin          = "user.login"
+	AuditEventLoginTwoFactor = "user.login_2fa"
+	AuditEventPasswordChange = "user.password_change"
+	AuditEventWithdrawal     = "balance.withdraw"
+	AuditEventAccrual        = "balance.accrual"
+	AuditEventAdjustment     = "balance.adjust"
+
+	auditTargetUser  = "user"
+	auditTargetOrder = "order"
+
+	auditReasonInternal = "internal error"
+)
+
+// auditedErrors are the failures whose message is stored as the reason of an
+// audit event, anything else is recorded as an internal error so that
+// implementation details don't end up in the log.
+var auditedErrors = []error{
+	domain.ErrUserExists,
+	domain.ErrIncorrectCredentials,
+	domain.ErrAccountClosed,
+	domain.ErrPasswordTooLong,
+	domain.ErrWeakPassword,
+	domain.ErrTwoFactorRequired,
+	domain.ErrInvalidTwoFactorCode,
+	domain.ErrInvalidChallenge,
+	domain.ErrTwoFactorLocked,
+	domain.ErrUserNotFound,
+	domain.ErrInsufficientFunds,
+	domain.ErrWithdrawalExists,
+	domain.ErrWithdrawalAddedByAnotherUser,
+}
+
+type auditRepository interface {
+	RecordAuditEvent(event domain.AuditEvent) error
+}
+
+type auditRecorder interface {
+	Record(event domain.AuditEvent)
+}
+
+// AuditService writes the security log of authentication and money events.
+type AuditService struct {
+	repo auditRepository
+}
+
+func NewAuditService(repo auditRepository) *AuditService {
+	return &AuditService{
+		repo: repo,
+	}
+}
+
+// Record stores an event. A failure is logged but never fails the operation
+// that is being audited.
+func (s *AuditService) Record(event domain.AuditEvent) {
+	if err := s.repo.RecordAuditEvent(event); err != nil {
+		logger.Log.Error("error while recording audit event", logger.String("event_type", event.Type), logger.Error(err))
+	}
+}
+
+func auditUser(eventType string, userID int64, client domain.ClientInfo) domain.AuditEvent {
+	return domain.AuditEvent{
+		ActorID:    &userID,
+		IP:         client.IP,
+		Type:       eventType,
+		TargetType: auditTargetUser,
+		TargetID:   strconv.FormatInt(userID, 10),
+		Outcome:    domain.AuditOutcomeSuccess,
+	}
+}
+
+func auditFailure(event domain.AuditEvent, err error) domain.AuditEvent {
+	event.Outcome = domain.AuditOutcomeFailure
+	event.Reason = auditReasonInternal
+	for _, known := range auditedErrors {
+		if errors.Is(err, known) {
+			event.Reason = known.Error()
+			break
+		}
+	}
+
+	return event
+}
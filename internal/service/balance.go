@@ -9,19 +9,38 @@ type balanceRepository interface {
 }
 
 type withdrawalRepository interface {
-	Withdrawals(userID int64) ([]domain.Withdrawal, error)
+	ListWithdrawals(userID int64, query domain.ListQuery) ([]domain.Withdrawal, error)
 	Withdraw(orderID string, amount float64, userID int64) error
 }
 
+type totpVerifier interface {
+	Enabled(userID int64) (bool, error)
+	VerifyTOTP(userID int64, code string) error
+}
+
 type BalanceService struct {
 	balanceRepo    balanceRepository
 	withdrawalRepo withdrawalRepository
+	twoFactor      totpVerifier
+	// twoFactorThreshold is the withdrawal sum above which users with
+	// two-factor authentication enabled have to provide a fresh TOTP code.
+	twoFactorThreshold float64
+	audit              auditRecorder
 }
 
-func NewBalanceService(balanceRepo balanceRepository, withdrawalRepo withdrawalRepository) *BalanceService {
+func NewBalanceService(
+	balanceRepo balanceRepository,
+	withdrawalRepo withdrawalRepository,
+	twoFactor totpVerifier,
+	twoFactorThreshold float64,
+	audit auditRecorder,
+) *BalanceService {
 	return &BalanceService{
-		balanceRepo:    balanceRepo,
-		withdrawalRepo: withdrawalRepo,
+		balanceRepo:        balanceRepo,
+		withdrawalRepo:     withdrawalRepo,
+		twoFactor:          twoFactor,
+		twoFactorThreshold: twoFactorThreshold,
+		audit:              audit,
 	}
 }
 
@@ -29,10 +48,58 @@ func (b BalanceService) Balance(userID int64) (*domain.Balance, error) {
 	return b.balanceRepo.Balance(userID)
 }
 
-func (b BalanceService) Withdraw(orderNumber string, sum float64, userID int64) error {
+func (b BalanceService) Withdraw(orderNumber string, sum float64, userID int64, totpCode string, client domain.ClientInfo) error {
+	event := domain.AuditEvent{
+		ActorID:    &userID,
+		IP:         client.IP,
+		Type:       AuditEventWithdrawal,
+		TargetType: auditTargetOrder,
+		TargetID:   orderNumber,
+		Outcome:    domain.AuditOutcomeSuccess,
+		Details:    details(map[string]any{"amount": sum}),
+	}
+
+	if err := b.withdraw(orderNumber, sum, userID, totpCode); err != nil {
+		b.audit.Record(auditFailure(event, err))
+		return err
+	}
+
+	b.audit.Record(event)
+
+	return nil
+}
+
+func (b BalanceService) withdraw(orderNumber string, sum float64, userID int64, totpCode string) error {
+	if sum > b.twoFactorThreshold {
+		enabled, err := b.twoFactor.Enabled(userID)
+		if err != nil {
+			return err
+		}
+
+		if enabled {
+			if totpCode == "" {
+				return domain.ErrTwoFactorRequired
+			}
+			if err = b.twoFactor.VerifyTOTP(userID, totpCode); err != nil {
+				return err
+			}
+		}
+	}
+
 	return b.withdrawalRepo.Withdraw(orderNumber, sum, userID)
 }
 
-func (b BalanceService) Withdrawals(userID int64) ([]domain.Withdrawal, error) {
-	return b.withdrawalRepo.Withdrawals(userID)
+// Withdrawals returns a page of the user's withdrawals and the cursor of the
+// next page.
+func (b BalanceService) Withdrawals(userID int64, query domain.ListQuery) ([]domain.Withdrawal, *domain.Cursor, error) {
+	withdrawals, err := b.withdrawalRepo.ListWithdrawals(userID, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	withdrawals, next := page(withdrawals, query.Limit, func(withdrawal domain.Withdrawal) domain.Cursor {
+		return domain.Cursor{At: withdrawal.ProcessedAt, ID: withdrawal.ID}
+	})
+
+	return withdrawals, next, nil
 }
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/password"
+	"github.com/koyif/gophermart/pkg/logger"
+)
+
+type adminBootstrapRepository interface {
+	CountUsersWithRole(role string) (int64, error)
+	CreateUserWithRole(login, hashedPassword, role string) (int64, error)
+}
+
+// BootstrapAdmin creates the first admin account. It refuses to run once any
+// admin exists.
+func BootstrapAdmin(
+	repo adminBootstrapRepository,
+	hasher password.Hasher,
+	policy passwordPolicy,
+	login, pass string,
+) (int64, error) {
+	admins, err := repo.CountUsersWithRole(domain.RoleAdmin)
+	if err != nil {
+		return 0, err
+	}
+	if admins > 0 {
+		return 0, domain.ErrAdminExists
+	}
+
+	if err = policy.Validate(pass); err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := hasher.Hash(pass)
+	if err != nil {
+		return 0, err
+	}
+
+	userID, err := repo.CreateUserWithRole(login, hashedPassword, domain.RoleAdmin)
+	if err != nil {
+		return 0, err
+	}
+
+	logger.Log.Info("admin created", logger.Int64("user_id", userID))
+
+	return userID, nil
+}
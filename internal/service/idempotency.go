@@ -0,0 +1,109 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/koyif/gophermart/internal/config"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+	"time"
+)
+
+const idempotencyPurgeInterval = time.Hour
+
+type idempotencyRepository interface {
+	ClaimIdempotencyKey(userID int64, key, requestHash string, lease time.Duration) (*domain.IdempotentResponse, error)
+	CompleteIdempotencyKey(userID int64, key string, response domain.IdempotentResponse, ttl time.Duration) error
+	ReleaseIdempotencyKey(userID int64, key string) error
+	DeleteExpiredIdempotencyKeys() (int64, error)
+}
+
+// IdempotencyService remembers the first response to a request made with an
+// Idempotency-Key, so that a retried request is answered with it instead of
+// being executed again. Keys are scoped to the user and kept for
+// IdempotencyKeyTTL once the request has finished, for IdempotencyKeyLease
+// while it runs, so that the key of a request that crashed can be used again.
+type IdempotencyService struct {
+	repo  idempotencyRepository
+	ttl   time.Duration
+	lease time.Duration
+}
+
+func NewIdempotencyService(repo idempotencyRepository, cfg *config.Config) *IdempotencyService {
+	return &IdempotencyService{
+		repo:  repo,
+		ttl:   cfg.IdempotencyKeyTTL,
+		lease: cfg.IdempotencyKeyLease,
+	}
+}
+
+// Begin claims the key for the request. It returns nil if the request has to
+// be executed, or the stored response if it is a replay. A key used with a
+// different request results in domain.ErrIdempotencyKeyReused, a key whose
+// first request hasn't finished yet in domain.ErrIdempotencyKeyInProgress.
+// headers are the values of the request headers that change its outcome, a
+// request with other values is a different one.
+func (s *IdempotencyService) Begin(userID int64, key, method, path string, headers []string, body []byte) (*domain.IdempotentResponse, error) {
+	hash := requestHash(method, path, headers, body)
+
+	stored, err := s.repo.ClaimIdempotencyKey(userID, key, hash, s.lease)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+
+	if stored.RequestHash != hash {
+		return nil, domain.ErrIdempotencyKeyReused
+	}
+	if stored.StatusCode == 0 {
+		return nil, domain.ErrIdempotencyKeyInProgress
+	}
+
+	return stored, nil
+}
+
+// Complete stores the response to the request that claimed the key.
+func (s *IdempotencyService) Complete(userID int64, key string, response domain.IdempotentResponse) error {
+	return s.repo.CompleteIdempotencyKey(userID, key, response, s.ttl)
+}
+
+// Release frees the key, e.g. after a server error, so that the request can be
+// retried with it.
+func (s *IdempotencyService) Release(userID int64, key string) error {
+	return s.repo.ReleaseIdempotencyKey(userID, key)
+}
+
+// PurgeExpired periodically deletes the keys whose TTL has passed.
+func (s *IdempotencyService) PurgeExpired(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := s.repo.DeleteExpiredIdempotencyKeys()
+				if err != nil {
+					logger.Log.Error("error while purging idempotency keys", logger.Error(err))
+					continue
+				}
+				if n > 0 {
+					logger.Log.Info("purged expired idempotency keys", logger.Int64("count", n))
+				}
+			}
+		}
+	}()
+}
+
+func requestHash(method, path string, headers []string, body []byte) string {
+	h := sha256.New()
+	for _, part := range append([]string{method, path}, headers...) {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(bytes.TrimSpace(body))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
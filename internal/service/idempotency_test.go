@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"github.com/koyif/gophermart/internal/config"
+	"github.com/koyif/gophermart/internal/domain"
+	"testing"
+	"time"
+)
+
+type fakeIdempotencyKeys struct {
+	keys  map[string]*domain.IdempotentResponse
+	lease time.Duration
+	ttl   time.Duration
+}
+
+func (f *fakeIdempotencyKeys) ClaimIdempotencyKey(_ int64, key, requestHash string, lease time.Duration) (*domain.IdempotentResponse, error) {
+	f.lease = lease
+	if stored, ok := f.keys[key]; ok {
+		copied := *stored
+		return &copied, nil
+	}
+
+	f.keys[key] = &domain.IdempotentResponse{RequestHash: requestHash}
+	return nil, nil
+}
+
+func (f *fakeIdempotencyKeys) CompleteIdempotencyKey(_ int64, key string, response domain.IdempotentResponse, ttl time.Duration) error {
+	f.ttl = ttl
+	response.RequestHash = f.keys[key].RequestHash
+	f.keys[key] = &response
+	return nil
+}
+
+func (f *fakeIdempotencyKeys) ReleaseIdempotencyKey(_ int64, key string) error {
+	delete(f.keys, key)
+	return nil
+}
+
+func (f *fakeIdempotencyKeys) DeleteExpiredIdempotencyKeys() (int64, error) {
+	return 0, nil
+}
+
+func TestIdempotencyServiceReplays(t *testing.T) {
+	repo := &fakeIdempotencyKeys{keys: make(map[string]*domain.IdempotentResponse)}
+	s := NewIdempotencyService(repo, &config.Config{IdempotencyKeyTTL: 24 * time.Hour, IdempotencyKeyLease: time.Minute})
+	headers := []string{"application/json", ""}
+	body := []byte(`{"order":"12345678903","sum":100}`)
+
+	stored, err := s.Begin(1, "key", "POST", "/api/user/balance/withdraw", headers, body)
+	if err != nil || stored != nil {
+		t.Fatalf("Begin() = %v, %v, want the key claimed", stored, err)
+	}
+	if repo.lease != time.Minute {
+		t.Fatalf("claimed for %v, want the lease", repo.lease)
+	}
+
+	if _, err = s.Begin(1, "key", "POST", "/api/user/balance/withdraw", headers, body); !errors.Is(err, domain.ErrIdempotencyKeyInProgress) {
+		t.Fatalf("Begin() while in progress error = %v, want ErrIdempotencyKeyInProgress", err)
+	}
+
+	response := domain.IdempotentResponse{StatusCode: 403, ContentType: "text/plain", Body: []byte("two-factor code required")}
+	if err = s.Complete(1, "key", response); err != nil {
+		t.Fatal(err)
+	}
+	if repo.ttl != 24*time.Hour {
+		t.Fatalf("completed for %v, want the TTL", repo.ttl)
+	}
+
+	stored, err = s.Begin(1, "key", "POST", "/api/user/balance/withdraw", headers, append(body, '\n'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.StatusCode != 403 || string(stored.Body) != "two-factor code required" {
+		t.Fatalf("Begin() = %+v, want the stored response", stored)
+	}
+}
+
+func TestIdempotencyServiceRejectsOtherRequests(t *testing.T) {
+	body := []byte(`{"order":"12345678903","sum":100}`)
+	first := []string{"application/json", ""}
+
+	tests := []struct {
+		name    string
+		path    string
+		headers []string
+		body    []byte
+	}{
+		{name: "other body", path: "/api/user/balance/withdraw", headers: first, body: []byte(`{"order":"12345678903","sum":200}`)},
+		{name: "other path", path: "/api/user/orders", headers: first, body: body},
+		{name: "two-factor code added", path: "/api/user/balance/withdraw", headers: []string{"application/json", "123456"}, body: body},
+		{name: "other content type", path: "/api/user/balance/withdraw", headers: []string{"text/plain", ""}, body: body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeIdempotencyKeys{keys: make(map[string]*domain.IdempotentResponse)}
+			s := NewIdempotencyService(repo, &config.Config{IdempotencyKeyTTL: time.Hour, IdempotencyKeyLease: time.Minute})
+
+			if _, err := s.Begin(1, "key", "POST", "/api/user/balance/withdraw", first, body); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Complete(1, "key", domain.IdempotentResponse{StatusCode: 403}); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.Begin(1, "key", "POST", tt.path, tt.headers, tt.body); !errors.Is(err, domain.ErrIdempotencyKeyReused) {
+				t.Fatalf("Begin() error = %v, want ErrIdempotencyKeyReused", err)
+			}
+		})
+	}
+}
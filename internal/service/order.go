@@ -3,29 +3,96 @@ package service
 import "github.com/koyif/gophermart/internal/domain"
 
 type OrderRepository interface {
-	CreateOrder(orderNumber string, userID int64) error
-	Orders(userID int64) ([]domain.Order, error)
+	CreateOrder(orderNumber string, userID int64, metadata domain.OrderMetadata, register bool) error
+	CreateOrders(numbers []string, userID int64) ([]domain.OrderUpload, error)
+	ListOrders(userID int64, query domain.ListQuery) ([]domain.Order, error)
+	Order(userID int64, number string) (*domain.Order, error)
+	OrderHistory(orderID int64) ([]domain.OrderStatusChange, error)
+	CancelOrder(userID int64, number string) error
+}
+
+// orderSources tells which orders are processed by an external accrual
+// system rather than the built-in rewards engine.
+type orderSources interface {
+	External(storeID, number string) bool
 }
 
 type OrderService struct {
-	repo OrderRepository
+	repo    OrderRepository
+	sources orderSources
 }
 
-func NewOrderService(repo OrderRepository) *OrderService {
+func NewOrderService(repo OrderRepository, sources orderSources) *OrderService {
 	return &OrderService{
-		repo: repo,
+		repo:    repo,
+		sources: sources,
 	}
 }
 
-func (s *OrderService) Create(orderNumber string, userID int64) error {
-	return s.repo.CreateOrder(orderNumber, userID)
+// Create uploads an order with the optional metadata of its purchase. Goods
+// of an order processed by the external accrual system are registered there.
+func (s *OrderService) Create(orderNumber string, userID int64, metadata domain.OrderMetadata) error {
+	register := len(metadata.Goods) > 0 && s.sources.External(metadata.StoreID, orderNumber)
+
+	return s.repo.CreateOrder(orderNumber, userID, metadata, register)
 }
 
-func (s *OrderService) Orders(userID int64) ([]domain.Order, error) {
-	orders, err := s.repo.Orders(userID)
+// CreateBatch uploads valid order numbers at once and returns the result of
+// each of them, in the order they were given. A number repeated in the batch
+// is accepted once and reported as already uploaded afterwards.
+func (s *OrderService) CreateBatch(numbers []string, userID int64) ([]domain.OrderUpload, error) {
+	uploads, err := s.repo.CreateOrders(numbers, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	return orders, nil
+	results := make(map[string]string, len(uploads))
+	for _, upload := range uploads {
+		results[upload.Number] = upload.Result
+	}
+
+	ordered := make([]domain.OrderUpload, len(numbers))
+	for i, number := range numbers {
+		ordered[i] = domain.OrderUpload{Number: number, Result: results[number]}
+		if results[number] == domain.OrderUploadAccepted {
+			results[number] = domain.OrderUploadAlreadyUploaded
+		}
+	}
+
+	return ordered, nil
+}
+
+// Orders returns a page of the user's orders and the cursor of the next page.
+func (s *OrderService) Orders(userID int64, query domain.ListQuery) ([]domain.Order, *domain.Cursor, error) {
+	orders, err := s.repo.ListOrders(userID, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	orders, next := page(orders, query.Limit, func(order domain.Order) domain.Cursor {
+		return domain.Cursor{At: order.UploadedAt, ID: order.ID}
+	})
+
+	return orders, next, nil
+}
+
+// Order returns the details of one of the user's orders.
+func (s *OrderService) Order(userID int64, number string) (*domain.OrderDetails, error) {
+	order, err := s.repo.Order(userID, number)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.OrderHistory(order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.OrderDetails{Order: *order, History: history}, nil
+}
+
+// Cancel withdraws an order of the user that hasn't been processed yet. The
+// order is kept as a CANCELLED tombstone and its number can be uploaded again.
+func (s *OrderService) Cancel(userID int64, number string) error {
+	return s.repo.CancelOrder(userID, number)
 }
@@ -4,29 +4,38 @@ import (
 	"context"
 	"github.com/koyif/gophermart/internal/domain"
 	"github.com/koyif/gophermart/pkg/logger"
+	"slices"
 	"sync"
 	"time"
 )
 
+// finalOrderStatuses are the statuses an order never leaves.
+var finalOrderStatuses = []string{"PROCESSED", "INVALID", "CANCELLED"}
+
 type orderProcessorRepository interface {
 	FetchPendingOrders() ([]domain.Order, error)
-	UpdateOrderStatus(orderID int64, status string, accrual *float64) error
+	ApplyAccrualCheck(check domain.AccrualCheck) (bool, error)
+	RecordOrderCheck(orderID int64) error
+	OrderByNumber(number string) (*domain.Order, error)
 }
 
-type userRepository interface {
-	UpdateUserBalance(userID int64, amount *float64) error
+// accrualRouter names the accrual provider an order is routed to.
+type accrualRouter interface {
+	Provider(order domain.Order) string
 }
 
 type OrderProcessor struct {
 	orderRepo orderProcessorRepository
-	userRepo  userRepository
+	providers accrualRouter
+	audit     auditRecorder
 	mu        *sync.RWMutex
 }
 
-func NewOrderProcessor(orderRepo orderProcessorRepository, userRepo userRepository) *OrderProcessor {
+func NewOrderProcessor(orderRepo orderProcessorRepository, providers accrualRouter, audit auditRecorder) *OrderProcessor {
 	return &OrderProcessor{
 		orderRepo: orderRepo,
-		userRepo:  userRepo,
+		providers: providers,
+		audit:     audit,
 		mu:        &sync.RWMutex{},
 	}
 }
@@ -45,7 +54,7 @@ func (p *OrderProcessor) ExtractOrders(ctx context.Context) <-chan domain.Order
 				orders, err := p.orderRepo.FetchPendingOrders()
 				if err != nil {
 					logger.Log.Error("error while fetching pending orders", logger.Error(err))
-					p.mu.Unlock()
+					p.mu.RUnlock()
 					continue
 				}
 				for _, order := range orders {
@@ -59,28 +68,99 @@ func (p *OrderProcessor) ExtractOrders(ctx context.Context) <-chan domain.Order
 	return inputCh
 }
 
-func (p *OrderProcessor) UpdateOrders(ctx context.Context, ordersCh <-chan domain.Order) {
+func (p *OrderProcessor) UpdateOrders(ctx context.Context, checksCh <-chan domain.AccrualCheck) {
 	go func() {
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case order := <-ordersCh:
-				p.mu.Lock()
-				err := p.orderRepo.UpdateOrderStatus(order.ID, order.Status, order.Accrual)
-				if err != nil {
-					p.mu.Unlock()
-					logger.Log.Error("error while updating order status", logger.Error(err))
-					continue
+			case check := <-checksCh:
+				if _, err := p.Apply(check); err != nil {
+					logger.Log.Error("error while applying accrual check", logger.String("number", check.Order.Number), logger.Error(err))
 				}
-				err = p.userRepo.UpdateUserBalance(order.UserID, order.Accrual)
-				if err != nil {
-					p.mu.Unlock()
-					logger.Log.Error("error while updating user balance", logger.Error(err))
-					return
-				}
-				p.mu.Unlock()
 			}
 		}
 	}()
 }
+
+// ApplyCallback handles an answer of the accrual system pushed to us instead
+// of polled. It goes the same way as a polled one, so a replayed callback
+// finds the order already in the reported status and doesn't credit it again.
+// Callbacks for orders in a final status are ignored, the accrual system never
+// changes its mind about a processed or invalid order. The answer is
+// attributed to the provider the order is routed to.
+func (p *OrderProcessor) ApplyCallback(number, status string, accrual *float64, response string) (bool, error) {
+	order, err := p.orderRepo.OrderByNumber(number)
+	if err != nil {
+		return false, err
+	}
+	if slices.Contains(finalOrderStatuses, order.Status) {
+		logger.Log.Warn(
+			"accrual callback for an order in a final status, skipping",
+			logger.String("number", number),
+			logger.String("status", order.Status),
+		)
+		return false, nil
+	}
+
+	return p.Apply(domain.AccrualCheck{
+		Order:    *order,
+		Status:   orderStatus(status),
+		Accrual:  accrual,
+		Response: response,
+		Provider: p.providers.Provider(*order),
+	})
+}
+
+// Apply moves the order to the status of the check and credits its accrual
+// once it is processed. It reports whether the order has changed.
+func (p *OrderProcessor) Apply(check domain.AccrualCheck) (bool, error) {
+	order := check.Order
+	if check.Status == "" || check.Status == order.Status {
+		if err := p.orderRepo.RecordOrderCheck(order.ID); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	order.Status = check.Status
+	order.Accrual = check.Accrual
+
+	p.mu.Lock()
+	applied, err := p.orderRepo.ApplyAccrualCheck(check)
+	p.mu.Unlock()
+	if err != nil {
+		p.recordAccrual(order, err)
+		return false, err
+	}
+	if !applied {
+		logger.Log.Warn("order changed while being checked, skipping", logger.String("number", order.Number))
+		return false, nil
+	}
+	p.recordAccrual(order, nil)
+
+	return true, nil
+}
+
+// recordAccrual audits crediting of a processed order, intermediate status
+// changes aren't money events.
+func (p *OrderProcessor) recordAccrual(order domain.Order, err error) {
+	if order.Status != "PROCESSED" {
+		return
+	}
+
+	event := domain.AuditEvent{
+		Type:       AuditEventAccrual,
+		TargetType: auditTargetOrder,
+		TargetID:   order.Number,
+		Outcome:    domain.AuditOutcomeSuccess,
+	}
+	if order.Accrual != nil {
+		event.Details = details(map[string]any{"user_id": order.UserID, "amount": *order.Accrual})
+	}
+	if err != nil {
+		event = auditFailure(event, err)
+	}
+
+	p.audit.Record(event)
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"github.com/koyif/gophermart/internal/domain"
+	"slices"
+	"testing"
+)
+
+// fakeOrders applies checks like the Postgres repository does: only to an
+// order still in the status the check was made for and not in a final one.
+type fakeOrders struct {
+	orders   map[string]*domain.Order
+	credited map[int64]float64
+	checks   int
+}
+
+func newFakeOrders(orders ...domain.Order) *fakeOrders {
+	f := &fakeOrders{orders: make(map[string]*domain.Order), credited: make(map[int64]float64)}
+	for i := range orders {
+		f.orders[orders[i].Number] = &orders[i]
+	}
+	return f
+}
+
+func (f *fakeOrders) FetchPendingOrders() ([]domain.Order, error) {
+	return nil, nil
+}
+
+func (f *fakeOrders) ApplyAccrualCheck(check domain.AccrualCheck) (bool, error) {
+	order := f.orders[check.Order.Number]
+	if order.Status != check.Order.Status || slices.Contains(finalOrderStatuses, order.Status) {
+		return false, nil
+	}
+
+	order.Status = check.Status
+	order.Accrual = check.Accrual
+	if check.Status == "PROCESSED" && check.Accrual != nil {
+		f.credited[order.UserID] += *check.Accrual
+	}
+	return true, nil
+}
+
+func (f *fakeOrders) RecordOrderCheck(int64) error {
+	f.checks++
+	return nil
+}
+
+func (f *fakeOrders) OrderByNumber(number string) (*domain.Order, error) {
+	order, ok := f.orders[number]
+	if !ok {
+		return nil, domain.ErrOrderNotFound
+	}
+	copied := *order
+	return &copied, nil
+}
+
+type fakeRouter struct{}
+
+func (fakeRouter) Provider(domain.Order) string {
+	return AccrualSourceHTTP
+}
+
+type fakeAudit struct {
+	events []domain.AuditEvent
+}
+
+func (a *fakeAudit) Record(event domain.AuditEvent) {
+	a.events = append(a.events, event)
+}
+
+func TestApplyCallbackCreditsOnce(t *testing.T) {
+	orders := newFakeOrders(domain.Order{ID: 1, Number: "12345678903", UserID: 7, Status: "PROCESSING"})
+	audit := &fakeAudit{}
+	processor := NewOrderProcessor(orders, fakeRouter{}, audit)
+	accrual := 500.0
+
+	for i, want := range []bool{true, false} {
+		applied, err := processor.ApplyCallback("12345678903", "PROCESSED", &accrual, `{}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied != want {
+			t.Fatalf("callback %d: applied = %v, want %v", i+1, applied, want)
+		}
+	}
+
+	if got := orders.credited[7]; got != accrual {
+		t.Fatalf("credited %v, want %v", got, accrual)
+	}
+	if len(audit.events) != 1 {
+		t.Fatalf("recorded %d audit events, want 1", len(audit.events))
+	}
+}
+
+func TestApplyCallbackIgnoresFinalOrders(t *testing.T) {
+	accrual := 500.0
+
+	for _, status := range finalOrderStatuses {
+		t.Run(status, func(t *testing.T) {
+			orders := newFakeOrders(domain.Order{ID: 1, Number: "12345678903", UserID: 7, Status: status})
+			processor := NewOrderProcessor(orders, fakeRouter{}, &fakeAudit{})
+
+			applied, err := processor.ApplyCallback("12345678903", "PROCESSED", &accrual, `{}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if applied {
+				t.Fatal("callback applied to an order in a final status")
+			}
+			if orders.orders["12345678903"].Status != status || orders.credited[7] != 0 {
+				t.Fatalf("order moved to %s with %v credited", orders.orders["12345678903"].Status, orders.credited[7])
+			}
+		})
+	}
+}
+
+func TestApplyCallbackUnknownOrder(t *testing.T) {
+	processor := NewOrderProcessor(newFakeOrders(), fakeRouter{}, &fakeAudit{})
+
+	if _, err := processor.ApplyCallback("12345678903", "PROCESSED", nil, `{}`); !errors.Is(err, domain.ErrOrderNotFound) {
+		t.Fatalf("ApplyCallback() error = %v, want ErrOrderNotFound", err)
+	}
+}
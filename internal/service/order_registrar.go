@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/koyif/gophermart/internal/config"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/pkg/logger"
+	"time"
+)
+
+const (
+	registrationInterval  = 5 * time.Second
+	registrationBatchSize = 100
+	registrationBaseDelay = 10 * time.Second
+	registrationMaxDelay  = time.Hour
+)
+
+// orderRegistry registers an order with the accrual provider it is routed
+// to. It returns the number of seconds to back off for if the provider is rate
+// limiting.
+type orderRegistry interface {
+	Register(ctx context.Context, registration domain.OrderRegistration) (int, error)
+}
+
+type orderRegistrationRepository interface {
+	OrdersToRegister(limit int) ([]domain.OrderRegistration, error)
+	MarkOrderRegistered(orderID int64) error
+	RetryOrderRegistration(orderID int64, reason string, delay time.Duration) error
+	FailOrderRegistration(orderID int64, reason string) error
+}
+
+// OrderRegistrar registers the orders uploaded with goods in the accrual
+// system. A failed registration is retried with exponential backoff up to
+// OrderRegistrationMaxAttempts times, an order the accrual system rejects
+// isn't retried. The registration status is kept apart from the accrual
+// status of the order, which is only polled once it is registered.
+type OrderRegistrar struct {
+	repo        orderRegistrationRepository
+	registry    orderRegistry
+	maxAttempts int
+}
+
+func NewOrderRegistrar(repo orderRegistrationRepository, registry orderRegistry, cfg *config.Config) *OrderRegistrar {
+	return &OrderRegistrar{
+		repo:        repo,
+		registry:    registry,
+		maxAttempts: cfg.OrderRegistrationMaxAttempts,
+	}
+}
+
+func (r *OrderRegistrar) Run(ctx context.Context) {
+	ticker := time.NewTicker(registrationInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.registerPending(ctx)
+			}
+		}
+	}()
+}
+
+func (r *OrderRegistrar) registerPending(ctx context.Context) {
+	registrations, err := r.repo.OrdersToRegister(registrationBatchSize)
+	if err != nil {
+		logger.Log.Error("error while fetching orders to register", logger.Error(err))
+		return
+	}
+
+	for _, registration := range registrations {
+		if ctx.Err() != nil {
+			return
+		}
+		r.register(ctx, registration)
+	}
+}
+
+func (r *OrderRegistrar) register(ctx context.Context, registration domain.OrderRegistration) {
+	// The provider of the order is backing off, or we are shutting down, the
+	// order stays due and is tried again with the next batch.
+	retryAfter, err := r.registry.Register(ctx, registration)
+	if retryAfter > 0 || ctx.Err() != nil {
+		return
+	}
+
+	if err == nil {
+		if err = r.repo.MarkOrderRegistered(registration.OrderID); err != nil {
+			logger.Log.Error("error while marking order registered", logger.String("number", registration.Number), logger.Error(err))
+		}
+		return
+	}
+
+	attempts := registration.Attempts + 1
+	if errors.Is(err, errOrderRejected) || attempts >= r.maxAttempts {
+		logger.Log.Error("giving up on order registration", logger.String("number", registration.Number), logger.Error(err))
+		if err = r.repo.FailOrderRegistration(registration.OrderID, err.Error()); err != nil {
+			logger.Log.Error("error while failing order registration", logger.String("number", registration.Number), logger.Error(err))
+		}
+		return
+	}
+
+	delay := registrationMaxDelay
+	if attempts < 16 {
+		delay = min(registrationBaseDelay<<(attempts-1), registrationMaxDelay)
+	}
+	logger.Log.Warn(
+		"error while registering order, retrying",
+		logger.String("number", registration.Number),
+		logger.Int64("attempt", int64(attempts)),
+		logger.Error(err),
+	)
+	if err = r.repo.RetryOrderRegistration(registration.OrderID, err.Error(), delay); err != nil {
+		logger.Log.Error("error while rescheduling order registration", logger.String("number", registration.Number), logger.Error(err))
+	}
+}
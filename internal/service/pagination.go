@@ -0,0 +1,16 @@
+package service
+
+import "github.com/koyif/gophermart/internal/domain"
+
+// page trims the extra item fetched by the repository and returns the cursor
+// of the next page, nil if this is the last one.
+func page[T any](items []T, limit int, cursor func(T) domain.Cursor) ([]T, *domain.Cursor) {
+	if limit <= 0 || len(items) <= limit {
+		return items, nil
+	}
+
+	items = items[:limit]
+	next := cursor(items[limit-1])
+
+	return items, &next
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"github.com/koyif/gophermart/internal/config"
+	"github.com/koyif/gophermart/internal/domain"
+	"time"
+)
+
+type pipelineRepository interface {
+	OrderStatusCounts() (map[string]int64, error)
+	CountStuckOrders(age time.Duration) (int64, error)
+	StuckOrders(age time.Duration, limit int) ([]domain.Order, error)
+}
+
+type accrualStats interface {
+	Stats() domain.AccrualStats
+}
+
+// PipelineService reports the state of order processing: how many orders
+// wait for the accrual system and how the accrual providers are doing.
+type PipelineService struct {
+	config  *config.Config
+	repo    pipelineRepository
+	accrual accrualStats
+}
+
+func NewPipelineService(repo pipelineRepository, config *config.Config, accrual accrualStats) *PipelineService {
+	return &PipelineService{
+		repo:    repo,
+		config:  config,
+		accrual: accrual,
+	}
+}
+
+func (s *PipelineService) Health() (*domain.PipelineHealth, error) {
+	counts, err := s.repo.OrderStatusCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	stuck, err := s.repo.CountStuckOrders(s.config.StuckOrderAge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.PipelineHealth{
+		OrdersByStatus: counts,
+		StuckOrders:    stuck,
+		Accrual:        s.accrual.Stats(),
+	}, nil
+}
+
+func (s *PipelineService) StuckOrders(limit int) ([]domain.Order, error) {
+	return s.repo.StuckOrders(s.config.StuckOrderAge, limit)
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"github.com/koyif/gophermart/internal/config"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/token"
+	"github.com/koyif/gophermart/pkg/logger"
+	"sync"
+	"time"
+)
+
+const (
+	sessionIDSize         = 16
+	maxUserAgentLength    = 512
+	sessionCacheSweepSize = 10000
+)
+
+type sessionRepository interface {
+	CreateSession(session domain.Session) error
+	Sessions(userID int64) ([]domain.Session, error)
+	TouchSession(sessionID string, userID int64) (string, error)
+	RevokeSession(userID int64, sessionID string) error
+	RevokeSessions(userID int64) error
+	Roles(userID int64) ([]string, error)
+	UserStatus(userID int64) (string, error)
+}
+
+type validatedSession struct {
+	userID int64
+	status string
+	at     time.Time
+}
+
+// SessionService issues tokens bound to session records and checks them on
+// every authenticated request. A session confirmed by the database is trusted
+// for SessionTouchInterval, so an active client causes at most one UPDATE per
+// interval, which also refreshes its last-seen time. The status of the user is
+// cached along with the session, Status reads it afresh for the requests that
+// must not rely on a status another replica may have changed meanwhile.
+type SessionService struct {
+	config    *config.Config
+	repo      sessionRepository
+	mu        *sync.Mutex
+	validated map[string]validatedSession
+}
+
+func NewSessionService(repo sessionRepository, config *config.Config) *SessionService {
+	return &SessionService{
+		repo:      repo,
+		config:    config,
+		mu:        &sync.Mutex{},
+		validated: make(map[string]validatedSession),
+	}
+}
+
+// Start creates a session for the client and returns a token bound to it and
+// carrying the current roles of the user.
+func (s *SessionService) Start(userID int64, client domain.ClientInfo) (string, error) {
+	roles, err := s.repo.Roles(userID)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := randomToken(sessionIDSize)
+	if err != nil {
+		return "", err
+	}
+
+	userAgent := client.UserAgent
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	err = s.repo.CreateSession(domain.Session{
+		ID:        id,
+		UserID:    userID,
+		UserAgent: userAgent,
+		IP:        client.IP,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token.Generate(userID, id, roles, s.config.PrivateKey)
+}
+
+// Validate checks that the session is alive and returns the status of its
+// user. Sessions of closed accounts are rejected with domain.ErrAccountClosed.
+func (s *SessionService) Validate(sessionID string, userID int64) (string, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	cached, ok := s.validated[sessionID]
+	s.mu.Unlock()
+	if ok && cached.userID == userID && now.Sub(cached.at) < s.config.SessionTouchInterval {
+		return cached.status, nil
+	}
+
+	status, err := s.repo.TouchSession(sessionID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status == "" {
+		delete(s.validated, sessionID)
+		return "", domain.ErrSessionRevoked
+	}
+	if status == domain.UserStatusClosed {
+		delete(s.validated, sessionID)
+		return "", domain.ErrAccountClosed
+	}
+
+	if len(s.validated) >= sessionCacheSweepSize {
+		s.sweep(now)
+	}
+	s.validated[sessionID] = validatedSession{userID: userID, status: status, at: now}
+
+	return status, nil
+}
+
+// Status returns the current status of the user, bypassing the cache.
+func (s *SessionService) Status(userID int64) (string, error) {
+	return s.repo.UserStatus(userID)
+}
+
+// Roles returns the current roles of the user, which may differ from the ones
+// in the token if they have changed since login.
+func (s *SessionService) Roles(userID int64) ([]string, error) {
+	return s.repo.Roles(userID)
+}
+
+func (s *SessionService) Sessions(userID int64) ([]domain.Session, error) {
+	return s.repo.Sessions(userID)
+}
+
+func (s *SessionService) Revoke(userID int64, sessionID string) error {
+	if err := s.repo.RevokeSession(userID, sessionID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.validated, sessionID)
+	s.mu.Unlock()
+
+	logger.Log.Info("session revoked", logger.Int64("user_id", userID))
+
+	return nil
+}
+
+// RevokeAll revokes every session of the user.
+func (s *SessionService) RevokeAll(userID int64) error {
+	if err := s.repo.RevokeSessions(userID); err != nil {
+		return err
+	}
+
+	s.Forget(userID)
+
+	logger.Log.Info("all sessions revoked", logger.Int64("user_id", userID))
+
+	return nil
+}
+
+// Forget drops the cached sessions of the user, so that the next request
+// picks up changes of the account such as its status.
+func (s *SessionService) Forget(userID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, cached := range s.validated {
+		if cached.userID == userID {
+			delete(s.validated, id)
+		}
+	}
+}
+
+func (s *SessionService) sweep(now time.Time) {
+	for id, cached := range s.validated {
+		if now.Sub(cached.at) >= s.config.SessionTouchInterval {
+			delete(s.validated, id)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/koyif/gophermart/internal/config"
+	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/totp"
+	"github.com/koyif/gophermart/pkg/logger"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodeCount       = 10
+	recoveryCodeLength      = 10
+	challengeMaxAttempts    = 5
+	totpAllowedSkew         = 1
+	challengeIDSize         = 32
+	recoveryCodeEntropySize = 8
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type twoFactorRepository interface {
+	UserByID(userID int64) (*domain.User, error)
+	TwoFactor(userID int64) (*domain.TwoFactor, error)
+	SetPendingTOTPSecret(userID int64, secret string) error
+	EnableTwoFactor(userID, step int64, recoveryCodeHashes []string) error
+	DisableTwoFactor(userID int64) error
+	UseTOTPStep(userID, step int64) (bool, error)
+	UseRecoveryCode(userID int64, codeHash string) (bool, error)
+	CreateTwoFactorChallenge(idHash string, userID int64, ttl time.Duration) (time.Time, error)
+	AttemptTwoFactorChallenge(idHash string, maxAttempts int) (int64, int, error)
+	DeleteTwoFactorChallenge(idHash string) error
+	RecordTwoFactorFailure(userID int64, maxFailures int, lockout time.Duration) (bool, error)
+	ResetTwoFactorFailures(userID int64) error
+}
+
+type TwoFactorService struct {
+	config *config.Config
+	repo   twoFactorRepository
+}
+
+func NewTwoFactorService(repo twoFactorRepository, config *config.Config) *TwoFactorService {
+	return &TwoFactorService{
+		repo:   repo,
+		config: config,
+	}
+}
+
+// Enroll generates a new TOTP secret. Two-factor authentication stays disabled
+// until the secret is confirmed with a valid code.
+func (s *TwoFactorService) Enroll(userID int64) (*domain.TOTPEnrollment, error) {
+	user, err := s.repo.UserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.repo.SetPendingTOTPSecret(userID, secret); err != nil {
+		return nil, err
+	}
+
+	return &domain.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.ProvisioningURI(s.config.TOTPIssuer, user.Login, secret),
+	}, nil
+}
+
+// Confirm enables two-factor authentication and returns one-time recovery
+// codes. Only their hashes are stored, so they can't be shown again.
+func (s *TwoFactorService) Confirm(userID int64, code string) ([]string, error) {
+	tf, err := s.repo.TwoFactor(userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf.Enabled {
+		return nil, domain.ErrTwoFactorAlreadyEnabled
+	}
+	if tf.Secret == "" {
+		return nil, domain.ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := totp.Validate(tf.Secret, code, time.Now(), totpAllowedSkew)
+	if !ok {
+		logger.Log.Warn("invalid TOTP confirmation code", logger.Int64("user_id", userID))
+		return nil, domain.ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hashSecret(normalizeRecoveryCode(codes[i]))
+	}
+
+	if err = s.repo.EnableTwoFactor(userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	logger.Log.Info("two-factor authentication enabled", logger.Int64("user_id", userID))
+
+	return codes, nil
+}
+
+func (s *TwoFactorService) Disable(userID int64, code string) error {
+	if err := s.Verify(userID, code); err != nil {
+		return err
+	}
+
+	if err := s.repo.DisableTwoFactor(userID); err != nil {
+		return err
+	}
+
+	logger.Log.Info("two-factor authentication disabled", logger.Int64("user_id", userID))
+
+	return nil
+}
+
+func (s *TwoFactorService) Enabled(userID int64) (bool, error) {
+	tf, err := s.repo.TwoFactor(userID)
+	if err != nil {
+		return false, err
+	}
+
+	return tf.Enabled, nil
+}
+
+// Verify accepts either a TOTP code or an unused recovery code.
+func (s *TwoFactorService) Verify(userID int64, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return s.VerifyTOTP(userID, code)
+	}
+
+	if _, err := s.enabled(userID); err != nil {
+		return err
+	}
+
+	ok, err := s.repo.UseRecoveryCode(userID, hashSecret(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		logger.Log.Warn("invalid recovery code", logger.Int64("user_id", userID))
+		return s.fail(userID)
+	}
+
+	logger.Log.Info("recovery code used", logger.Int64("user_id", userID))
+
+	return s.repo.ResetTwoFactorFailures(userID)
+}
+
+// VerifyTOTP accepts only a TOTP code that hasn't been used before.
+func (s *TwoFactorService) VerifyTOTP(userID int64, code string) error {
+	tf, err := s.enabled(userID)
+	if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(tf.Secret, strings.TrimSpace(code), time.Now(), totpAllowedSkew)
+	if !ok {
+		logger.Log.Warn("invalid TOTP code", logger.Int64("user_id", userID))
+		return s.fail(userID)
+	}
+
+	fresh, err := s.repo.UseTOTPStep(userID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		logger.Log.Warn("reused TOTP code", logger.Int64("user_id", userID))
+		return s.fail(userID)
+	}
+
+	return s.repo.ResetTwoFactorFailures(userID)
+}
+
+// enabled returns the two-factor settings of a user whose codes can be
+// checked.
+func (s *TwoFactorService) enabled(userID int64) (*domain.TwoFactor, error) {
+	tf, err := s.repo.TwoFactor(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !tf.Enabled {
+		return nil, domain.ErrTwoFactorNotEnrolled
+	}
+	if tf.Locked {
+		return nil, domain.ErrTwoFactorLocked
+	}
+
+	return tf, nil
+}
+
+// fail counts an invalid code of the user, too many of them in a row lock
+// the codes of the user for a while.
+func (s *TwoFactorService) fail(userID int64) error {
+	locked, err := s.repo.RecordTwoFactorFailure(userID, s.config.TwoFactorMaxFailures, s.config.TwoFactorLockout)
+	if err != nil {
+		return err
+	}
+	if locked {
+		logger.Log.Warn("two-factor codes locked after too many failures", logger.Int64("user_id", userID))
+		return domain.ErrTwoFactorLocked
+	}
+
+	return domain.ErrInvalidTwoFactorCode
+}
+
+// CreateChallenge starts the second step of a login, unless the codes of the
+// user are locked and it couldn't be completed anyway.
+func (s *TwoFactorService) CreateChallenge(userID int64) (*domain.TwoFactorChallenge, error) {
+	if _, err := s.enabled(userID); err != nil {
+		return nil, err
+	}
+
+	id, err := randomToken(challengeIDSize)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt, err := s.repo.CreateTwoFactorChallenge(hashSecret(id), userID, s.config.TwoFactorChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.TwoFactorChallenge{
+		ID:        id,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// CompleteChallenge checks the code for a login challenge and returns the
+// user the challenge was issued for. A challenge can be completed only once
+// and is dropped after challengeMaxAttempts invalid codes or once the codes of
+// the user get locked.
+func (s *TwoFactorService) CompleteChallenge(challengeID, code string) (int64, error) {
+	idHash := hashSecret(challengeID)
+
+	userID, attempts, err := s.repo.AttemptTwoFactorChallenge(idHash, challengeMaxAttempts)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = s.Verify(userID, code); err != nil {
+		if errors.Is(err, domain.ErrTwoFactorLocked) || attempts >= challengeMaxAttempts {
+			if delErr := s.repo.DeleteTwoFactorChallenge(idHash); delErr != nil {
+				logger.Log.Error("error while dropping two-factor challenge", logger.Int64("user_id", userID), logger.Error(delErr))
+			}
+		}
+		return 0, err
+	}
+
+	if err = s.repo.DeleteTwoFactorChallenge(idHash); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeEntropySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating recovery code: %w", err)
+	}
+
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))[:recoveryCodeLength]
+
+	return code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating random token: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -3,74 +3,247 @@ package service
 import (
 	"errors"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
-	"github.com/koyif/gophermart/internal/config"
 	"github.com/koyif/gophermart/internal/domain"
+	"github.com/koyif/gophermart/internal/password"
 	"github.com/koyif/gophermart/pkg/logger"
-	"golang.org/x/crypto/bcrypt"
 	"strconv"
 )
 
 type UserRepository interface {
 	CreateUser(login, hashedPassword string) (int64, error)
 	User(login string) (*domain.User, error)
+	UserByID(userID int64) (*domain.User, error)
+	UpdatePasswordHash(userID int64, hashedPassword string) error
+}
+
+type passwordPolicy interface {
+	Validate(password string) error
+}
+
+type twoFactorChallenger interface {
+	CreateChallenge(userID int64) (*domain.TwoFactorChallenge, error)
+	CompleteChallenge(challengeID, code string) (int64, error)
+}
+
+type sessionStarter interface {
+	Start(userID int64, client domain.ClientInfo) (string, error)
+	RevokeAll(userID int64) error
 }
 
 type UserService struct {
-	config *config.Config
-	repo   UserRepository
+	repo      UserRepository
+	hasher    password.Hasher
+	policy    passwordPolicy
+	twoFactor twoFactorChallenger
+	sessions  sessionStarter
+	audit     auditRecorder
 }
 
-func NewUserService(repo UserRepository, config *config.Config) *UserService {
+func NewUserService(
+	repo UserRepository,
+	hasher password.Hasher,
+	policy passwordPolicy,
+	twoFactor twoFactorChallenger,
+	sessions sessionStarter,
+	audit auditRecorder,
+) *UserService {
 	return &UserService{
-		repo:   repo,
-		config: config,
+		repo:      repo,
+		hasher:    hasher,
+		policy:    policy,
+		twoFactor: twoFactor,
+		sessions:  sessions,
+		audit:     audit,
 	}
 }
 
-func (s *UserService) Register(login, password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+func (s *UserService) Register(login, password string, client domain.ClientInfo) (string, error) {
+	attempt := domain.AuditEvent{IP: client.IP, Type: AuditEventRegister}
+
+	if err := s.policy.Validate(password); err != nil {
+		s.audit.Record(auditFailure(attempt, err))
+		return "", err
+	}
+
+	hashedPassword, err := s.hashPassword(password)
 	if err != nil {
-		logger.Log.Warn("error while hashing password")
-		return "", fmt.Errorf("error while hashing password: %w", err)
+		s.audit.Record(auditFailure(attempt, err))
+		return "", err
 	}
 
-	userID, err := s.repo.CreateUser(login, string(hashedPassword))
+	userID, err := s.repo.CreateUser(login, hashedPassword)
 	if err != nil {
+		s.audit.Record(auditFailure(attempt, err))
 		return "", err
 	}
 
-	return generateJWTToken(userID, s.config.PrivateKey)
+	s.audit.Record(auditUser(AuditEventRegister, userID, client))
+
+	return s.sessions.Start(userID, client)
 }
 
-func (s *UserService) Login(login, password string) (string, error) {
+func (s *UserService) Login(login, password string, client domain.ClientInfo) (*domain.LoginResult, error) {
+	attempt := domain.AuditEvent{IP: client.IP, Type: AuditEventLogin}
+
 	user, err := s.repo.User(login)
 	if err != nil {
 		if errors.Is(err, domain.ErrIncorrectCredentials) {
-			logger.Log.Warn("incorrect login", logger.String("login", login))
+			logger.Log.Warn("login attempt for unknown user")
+		}
+		s.audit.Record(auditFailure(attempt, err))
+		return nil, err
+	}
+
+	attempt.TargetType = auditTargetUser
+	attempt.TargetID = strconv.FormatInt(user.ID, 10)
+
+	match, rehash, err := s.hasher.Verify(user.Password, password)
+	if err != nil {
+		logger.Log.Error("error while verifying password", logger.Int64("user_id", user.ID), logger.Error(err))
+		s.audit.Record(auditFailure(attempt, err))
+		return nil, fmt.Errorf("error while verifying password: %w", err)
+	}
+	if !match {
+		logger.Log.Warn("incorrect password", logger.Int64("user_id", user.ID))
+		s.audit.Record(auditFailure(attempt, domain.ErrIncorrectCredentials))
+		return nil, domain.ErrIncorrectCredentials
+	}
+
+	if user.Status == domain.UserStatusClosed {
+		logger.Log.Warn("login attempt for a closed account", logger.Int64("user_id", user.ID))
+		s.audit.Record(auditFailure(attempt, domain.ErrAccountClosed))
+		return nil, domain.ErrAccountClosed
+	}
+
+	if rehash {
+		s.rehashPassword(user.ID, password)
+	}
+
+	if user.TwoFactor {
+		challenge, err := s.twoFactor.CreateChallenge(user.ID)
+		if err != nil {
+			s.audit.Record(auditFailure(attempt, err))
+			return nil, err
 		}
+
+		attempt.Outcome = domain.AuditOutcomeChallenged
+		s.audit.Record(attempt)
+
+		return &domain.LoginResult{Challenge: challenge}, nil
+	}
+
+	t, err := s.sessions.Start(user.ID, client)
+	if err != nil {
+		s.audit.Record(auditFailure(attempt, err))
+		return nil, err
+	}
+
+	s.audit.Record(auditUser(AuditEventLogin, user.ID, client))
+
+	return &domain.LoginResult{Token: t}, nil
+}
+
+// CompleteLogin finishes a login of a user with two-factor authentication
+// enabled by exchanging a challenge and a valid code for a token.
+func (s *UserService) CompleteLogin(challengeID, code string, client domain.ClientInfo) (string, error) {
+	userID, err := s.twoFactor.CompleteChallenge(challengeID, code)
+	if err != nil {
+		s.audit.Record(auditFailure(domain.AuditEvent{IP: client.IP, Type: AuditEventLoginTwoFactor}, err))
+		return "", err
+	}
+
+	t, err := s.sessions.Start(userID, client)
+	if err != nil {
+		s.audit.Record(auditFailure(auditUser(AuditEventLoginTwoFactor, userID, client), err))
+		return "", err
+	}
+
+	s.audit.Record(auditUser(AuditEventLoginTwoFactor, userID, client))
+
+	return t, nil
+}
+
+// ChangePassword replaces the password of an authenticated user after checking
+// the current one. Every existing session is revoked, the returned token is
+// bound to a new one.
+func (s *UserService) ChangePassword(userID int64, currentPassword, newPassword string, client domain.ClientInfo) (string, error) {
+	event := auditUser(AuditEventPasswordChange, userID, client)
+
+	t, err := s.changePassword(userID, currentPassword, newPassword, client)
+	if err != nil {
+		s.audit.Record(auditFailure(event, err))
 		return "", err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	s.audit.Record(event)
+
+	return t, nil
+}
+
+func (s *UserService) changePassword(userID int64, currentPassword, newPassword string, client domain.ClientInfo) (string, error) {
+	user, err := s.repo.UserByID(userID)
+	if err != nil {
+		return "", err
+	}
+
+	match, _, err := s.hasher.Verify(user.Password, currentPassword)
 	if err != nil {
-		logger.Log.Warn("incorrect password", logger.String("login", login))
+		logger.Log.Error("error while verifying password", logger.Int64("user_id", userID), logger.Error(err))
+		return "", fmt.Errorf("error while verifying password: %w", err)
+	}
+	if !match {
+		logger.Log.Warn("incorrect current password", logger.Int64("user_id", userID))
 		return "", domain.ErrIncorrectCredentials
 	}
 
-	return generateJWTToken(user.ID, s.config.PrivateKey)
+	if err = s.policy.Validate(newPassword); err != nil {
+		return "", err
+	}
+
+	hashedPassword, err := s.hashPassword(newPassword)
+	if err != nil {
+		return "", err
+	}
+
+	if err = s.repo.UpdatePasswordHash(userID, hashedPassword); err != nil {
+		return "", err
+	}
+
+	if err = s.sessions.RevokeAll(userID); err != nil {
+		return "", err
+	}
+
+	logger.Log.Info("password changed", logger.Int64("user_id", userID))
+
+	return s.sessions.Start(userID, client)
 }
 
-func generateJWTToken(userID int64, privateKey string) (string, error) {
-	claims := jwt.MapClaims{
-		"sub": strconv.FormatInt(userID, 10),
+func (s *UserService) hashPassword(password string) (string, error) {
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		logger.Log.Warn("error while hashing password")
+		if errors.Is(err, domain.ErrPasswordTooLong) {
+			return "", err
+		}
+		return "", fmt.Errorf("error while hashing password: %w", err)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(privateKey))
+	return hashedPassword, nil
+}
+
+// rehashPassword upgrades a stored hash to the current algorithm and parameters.
+// Failures are only logged: the user has already been authenticated.
+func (s *UserService) rehashPassword(userID int64, password string) {
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
-		return "", fmt.Errorf("error while signing token: %w", err)
+		logger.Log.Warn("error while rehashing password", logger.Int64("user_id", userID), logger.Error(err))
+		return
+	}
+
+	if err = s.repo.UpdatePasswordHash(userID, hashedPassword); err != nil {
+		logger.Log.Error("error while storing rehashed password", logger.Int64("user_id", userID), logger.Error(err))
+		return
 	}
 
-	return signedToken, nil
+	logger.Log.Info("password hash upgraded", logger.Int64("user_id", userID))
 }
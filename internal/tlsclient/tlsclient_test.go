@@ -0,0 +1,300 @@
+package tlsclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const serverDNSName = "accrual.internal"
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(t *testing.T, name string) *authority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &authority{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns the PEM certificate and key of a leaf signed by the authority.
+func (a *authority) issue(t *testing.T, name string, usage x509.ExtKeyUsage, dnsNames ...string) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     dnsNames,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+// newServer starts a TLS server requiring a client certificate signed by one
+// of clientCAs. It answers with the common name of the client certificate.
+func newServer(t *testing.T, ca *authority, maxVersion uint16, clientCAs ...*authority) *httptest.Server {
+	t.Helper()
+
+	certPEM, keyPEM := ca.issue(t, "server", x509.ExtKeyUsageServerAuth, serverDNSName)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	for _, clientCA := range clientCAs {
+		pool.AddCert(clientCA.cert)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MaxVersion:   maxVersion,
+	}
+	// Refused handshakes are expected, not worth logging.
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func writeFile(t *testing.T, path string, data []byte, mod time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Rewrites within the same clock tick must still look changed.
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeFiles writes the client certificate, its key and the CA bundle and
+// returns the options pointing to them.
+func writeFiles(t *testing.T, dir string, certPEM, keyPEM, caPEM []byte) Options {
+	t.Helper()
+
+	opts := Options{
+		CertFile: filepath.Join(dir, "client.crt"),
+		KeyFile:  filepath.Join(dir, "client.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+	}
+	mod := time.Now()
+	writeFile(t, opts.CertFile, certPEM, mod)
+	writeFile(t, opts.KeyFile, keyPEM, mod)
+	writeFile(t, opts.CAFile, caPEM, mod)
+
+	return opts
+}
+
+// get calls the server with the TLS configuration built from opts and returns
+// the common name the server saw.
+func get(t *testing.T, srv *httptest.Server, opts Options) (string, error) {
+	t.Helper()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := New(opts, u.Hostname())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return getWith(t, srv, cfg)
+}
+
+func getWith(t *testing.T, srv *httptest.Server, cfg *tls.Config) (string, error) {
+	t.Helper()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, DisableKeepAlives: true}}
+	response, err := client.Get(srv.URL)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body), nil
+}
+
+func TestNew(t *testing.T) {
+	ca := newAuthority(t, "ca")
+	otherCA := newAuthority(t, "other ca")
+	srv := newServer(t, ca, 0, ca)
+	certPEM, keyPEM := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+
+	tests := []struct {
+		name       string
+		caPEM      []byte
+		serverName string
+		wantErr    bool
+	}{
+		{name: "mutual TLS", caPEM: ca.pem, serverName: serverDNSName},
+		{name: "unknown CA", caPEM: otherCA.pem, serverName: serverDNSName, wantErr: true},
+		{name: "server name not overridden", caPEM: ca.pem, wantErr: true},
+		{name: "wrong server name", caPEM: ca.pem, serverName: "other.internal", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := writeFiles(t, t.TempDir(), certPEM, keyPEM, tt.caPEM)
+			opts.ServerName = tt.serverName
+
+			name, err := get(t, srv, opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected the handshake to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name != "client" {
+				t.Fatalf("server saw client %q, want %q", name, "client")
+			}
+		})
+	}
+}
+
+func TestNewMinVersion(t *testing.T) {
+	ca := newAuthority(t, "ca")
+	srv := newServer(t, ca, tls.VersionTLS12, ca)
+	certPEM, keyPEM := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	opts := writeFiles(t, t.TempDir(), certPEM, keyPEM, ca.pem)
+	opts.ServerName = serverDNSName
+
+	opts.MinVersion = "1.2"
+	if _, err := get(t, srv, opts); err != nil {
+		t.Fatalf("unexpected error with TLS 1.2: %v", err)
+	}
+
+	opts.MinVersion = "1.3"
+	if _, err := get(t, srv, opts); err == nil {
+		t.Fatal("expected a server limited to TLS 1.2 to be refused")
+	}
+
+	opts.MinVersion = "1.4"
+	if _, err := New(opts, "127.0.0.1"); err == nil {
+		t.Fatal("expected an unknown version to be refused")
+	}
+}
+
+func TestNewReloadsRewrittenFiles(t *testing.T) {
+	ca := newAuthority(t, "ca")
+	rotatedCA := newAuthority(t, "rotated ca")
+	srv := newServer(t, ca, 0, ca, rotatedCA)
+
+	certPEM, keyPEM := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	opts := writeFiles(t, t.TempDir(), certPEM, keyPEM, ca.pem)
+	opts.ServerName = serverDNSName
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := New(opts, u.Hostname())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := getWith(t, srv, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name != "client" {
+		t.Fatalf("server saw client %q, want %q", name, "client")
+	}
+
+	certPEM, keyPEM = rotatedCA.issue(t, "rotated client", x509.ExtKeyUsageClientAuth)
+	mod := time.Now().Add(time.Minute)
+	writeFile(t, opts.CertFile, certPEM, mod)
+	writeFile(t, opts.KeyFile, keyPEM, mod)
+
+	name, err = getWith(t, srv, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error after rotation: %v", err)
+	}
+	if name != "rotated client" {
+		t.Fatalf("server saw client %q, want %q", name, "rotated client")
+	}
+
+	// A bundle without the CA of the server makes the next handshake fail.
+	writeFile(t, opts.CAFile, rotatedCA.pem, mod)
+	if _, err = getWith(t, srv, cfg); err == nil {
+		t.Fatal("expected the rewritten CA bundle to be used")
+	}
+}
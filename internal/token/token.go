@@ -0,0 +1,66 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"strconv"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type Claims struct {
+	jwt.StandardClaims
+	// SessionID ties the token to a row in the sessions table, revoking the
+	// session revokes the token.
+	SessionID string `json:"sid"`
+	// Roles are fixed when the token is issued, role changes take effect on
+	// the next login.
+	Roles []string `json:"roles,omitempty"`
+}
+
+func (c Claims) UserID() (int64, error) {
+	userID, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: malformed subject: %v", ErrInvalidToken, err)
+	}
+
+	return userID, nil
+}
+
+func Generate(userID int64, sessionID string, roles []string, privateKey string) (string, error) {
+	claims := Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject: strconv.FormatInt(userID, 10),
+		},
+		SessionID: sessionID,
+		Roles:     roles,
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signedToken, err := t.SignedString([]byte(privateKey))
+	if err != nil {
+		return "", fmt.Errorf("error while signing token: %w", err)
+	}
+
+	return signedToken, nil
+}
+
+func Parse(tokenString, privateKey string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return []byte(privateKey), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.SessionID == "" {
+		return nil, fmt.Errorf("%w: missing session", ErrInvalidToken)
+	}
+
+	return &claims, nil
+}
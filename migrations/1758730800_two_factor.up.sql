@@ -0,0 +1,21 @@
+ALTER TABLE users
+    ADD COLUMN totp_secret    VARCHAR(64),
+    ADD COLUMN totp_enabled   BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN totp_last_step BIGINT  NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes
+(
+    id        INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    user_id   INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at   TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_challenges
+(
+    id         VARCHAR(64) PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    attempts   INTEGER     NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP   NOT NULL
+);
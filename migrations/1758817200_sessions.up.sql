@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id           VARCHAR(32) PRIMARY KEY,
+    user_id      INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_agent   TEXT        NOT NULL DEFAULT '',
+    ip           VARCHAR(45) NOT NULL DEFAULT '',
+    created_at   TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_at   TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
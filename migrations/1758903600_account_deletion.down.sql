@@ -0,0 +1,11 @@
+ALTER TABLE withdrawals
+    DROP CONSTRAINT withdrawals_user_id_fkey,
+    ADD CONSTRAINT withdrawals_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id);
+
+ALTER TABLE orders
+    DROP CONSTRAINT orders_user_id_fkey,
+    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id);
+
+ALTER TABLE users DROP COLUMN deleted_at;
+
+DROP TABLE IF EXISTS balance_history;
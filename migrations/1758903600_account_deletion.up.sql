@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS balance_history
+(
+    id         INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+    kind       VARCHAR(16) NOT NULL CHECK (kind IN ('ACCRUAL', 'WITHDRAWAL')),
+    amount     FLOAT       NOT NULL,
+    reference  VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS balance_history_user_id_idx ON balance_history (user_id, created_at);
+
+INSERT INTO balance_history (user_id, kind, amount, reference, created_at)
+SELECT user_id, 'ACCRUAL', accrual, number, uploaded_at
+FROM orders
+WHERE accrual IS NOT NULL
+  AND accrual <> 0;
+
+INSERT INTO balance_history (user_id, kind, amount, reference, created_at)
+SELECT user_id, 'WITHDRAWAL', -amount, order_number, processed_at
+FROM withdrawals;
+
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+
+-- Deleted accounts are anonymized instead of removed, financial records must
+-- never disappear together with a user row.
+ALTER TABLE orders
+    DROP CONSTRAINT orders_user_id_fkey,
+    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE RESTRICT;
+
+ALTER TABLE withdrawals
+    DROP CONSTRAINT withdrawals_user_id_fkey,
+    ADD CONSTRAINT withdrawals_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE RESTRICT;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role       VARCHAR(16) NOT NULL CHECK (role IN ('admin', 'operator')),
+    granted_at TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS user_roles_role_idx ON user_roles (role);
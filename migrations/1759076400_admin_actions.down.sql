@@ -0,0 +1,7 @@
+DELETE FROM balance_history WHERE kind = 'ADJUSTMENT';
+
+ALTER TABLE balance_history
+    DROP CONSTRAINT balance_history_kind_check,
+    ADD CONSTRAINT balance_history_kind_check CHECK (kind IN ('ACCRUAL', 'WITHDRAWAL'));
+
+DROP TABLE IF EXISTS admin_actions;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS admin_actions
+(
+    id          INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    admin_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+    action      VARCHAR(32) NOT NULL,
+    target_type VARCHAR(16) NOT NULL DEFAULT '',
+    target_id   VARCHAR(64) NOT NULL DEFAULT '',
+    reason      TEXT        NOT NULL DEFAULT '',
+    details     JSONB,
+    created_at  TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS admin_actions_admin_id_idx ON admin_actions (admin_id, created_at);
+
+ALTER TABLE balance_history
+    DROP CONSTRAINT balance_history_kind_check,
+    ADD CONSTRAINT balance_history_kind_check CHECK (kind IN ('ACCRUAL', 'WITHDRAWAL', 'ADJUSTMENT'));
@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    id          BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    occurred_at TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    actor_id    INTEGER REFERENCES users (id) ON DELETE RESTRICT,
+    ip          VARCHAR(64) NOT NULL DEFAULT '',
+    event_type  VARCHAR(32) NOT NULL,
+    target_type VARCHAR(16) NOT NULL DEFAULT '',
+    target_id   VARCHAR(64) NOT NULL DEFAULT '',
+    outcome     VARCHAR(16) NOT NULL CHECK (outcome IN ('success', 'failure', 'challenged')),
+    reason      TEXT        NOT NULL DEFAULT '',
+    details     JSONB
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_occurred_at_idx ON audit_events (occurred_at);
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id, occurred_at);
+CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id, occurred_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update_delete
+    BEFORE UPDATE OR DELETE
+    ON audit_events
+    FOR EACH ROW
+EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE
+    ON audit_events
+    FOR EACH STATEMENT
+EXECUTE FUNCTION audit_events_append_only();
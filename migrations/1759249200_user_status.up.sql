@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'suspended', 'closed'));
+
+UPDATE users SET status = 'closed' WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS check_count,
+    DROP COLUMN IF EXISTS last_checked_at,
+    DROP COLUMN IF EXISTS status_changed_at;
@@ -0,0 +1,4 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS last_checked_at   TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS check_count       INTEGER NOT NULL DEFAULT 0;
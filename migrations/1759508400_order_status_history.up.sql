@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS order_status_history
+(
+    id               BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    order_id         INTEGER     NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    status           VARCHAR(16) NOT NULL,
+    accrual          FLOAT,
+    accrual_response JSONB,
+    changed_at       TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS order_status_history_order_id_idx ON order_status_history (order_id, id);
+
+INSERT INTO order_status_history (order_id, status, changed_at)
+SELECT id, 'NEW', uploaded_at
+FROM orders;
+
+INSERT INTO order_status_history (order_id, status, accrual, changed_at)
+SELECT id, status, accrual, COALESCE(status_changed_at, uploaded_at)
+FROM orders
+WHERE status <> 'NEW';
@@ -0,0 +1,5 @@
+ALTER TABLE balance_history ALTER COLUMN reference TYPE VARCHAR(32);
+
+ALTER TABLE withdrawals ALTER COLUMN order_number TYPE VARCHAR(32);
+
+ALTER TABLE orders ALTER COLUMN number TYPE VARCHAR(32);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    user_id       INTEGER      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    key           VARCHAR(255) NOT NULL,
+    request_hash  CHAR(64)     NOT NULL,
+    status_code   INTEGER,
+    content_type  VARCHAR(255) NOT NULL DEFAULT '',
+    response_body BYTEA,
+    created_at    TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at    TIMESTAMP    NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
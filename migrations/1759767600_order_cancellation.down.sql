@@ -0,0 +1,13 @@
+DELETE FROM orders WHERE status = 'CANCELLED';
+
+DROP INDEX IF EXISTS orders_number_idx;
+DROP INDEX IF EXISTS orders_number_active_idx;
+ALTER TABLE orders
+    ADD CONSTRAINT orders_number_key UNIQUE (number);
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders
+    ADD CONSTRAINT orders_status_check CHECK (status IN ('NEW', 'INVALID', 'PROCESSING', 'PROCESSED'));
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS cancelled_at;
@@ -0,0 +1,11 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders
+    ADD CONSTRAINT orders_status_check CHECK (status IN ('NEW', 'INVALID', 'PROCESSING', 'PROCESSED', 'CANCELLED'));
+
+-- A cancelled order stays as a tombstone and no longer holds its number.
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_number_key;
+CREATE UNIQUE INDEX IF NOT EXISTS orders_number_active_idx ON orders (number) WHERE status <> 'CANCELLED';
+CREATE INDEX IF NOT EXISTS orders_number_idx ON orders (number);
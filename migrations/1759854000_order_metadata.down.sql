@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS orders_store_id_idx;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS purchased_at,
+    DROP COLUMN IF EXISTS currency,
+    DROP COLUMN IF EXISTS purchase_amount,
+    DROP COLUMN IF EXISTS store_id;
@@ -0,0 +1,7 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS store_id        VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS purchase_amount FLOAT CHECK (purchase_amount >= 0),
+    ADD COLUMN IF NOT EXISTS currency        CHAR(3),
+    ADD COLUMN IF NOT EXISTS purchased_at    TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS orders_store_id_idx ON orders (store_id) WHERE store_id IS NOT NULL;
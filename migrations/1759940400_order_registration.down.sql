@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS orders_registration_pending_idx;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS registration_error,
+    DROP COLUMN IF EXISTS registration_next_at,
+    DROP COLUMN IF EXISTS registration_attempts,
+    DROP COLUMN IF EXISTS registration_status,
+    DROP COLUMN IF EXISTS goods;
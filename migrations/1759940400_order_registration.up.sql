@@ -0,0 +1,8 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS goods                 JSONB,
+    ADD COLUMN IF NOT EXISTS registration_status   VARCHAR(16) CHECK (registration_status IN ('PENDING', 'REGISTERED', 'FAILED')),
+    ADD COLUMN IF NOT EXISTS registration_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS registration_next_at  TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS registration_error    TEXT;
+
+CREATE INDEX IF NOT EXISTS orders_registration_pending_idx ON orders (registration_next_at) WHERE registration_status = 'PENDING';
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS reward_rules
+(
+    id          INTEGER PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    name        VARCHAR(255) NOT NULL,
+    store_id    VARCHAR(64),
+    match       VARCHAR(255) NOT NULL DEFAULT '',
+    reward_type VARCHAR(16)  NOT NULL CHECK (reward_type IN ('percent', 'fixed')),
+    reward      FLOAT        NOT NULL CHECK (reward > 0),
+    valid_from  TIMESTAMP,
+    valid_to    TIMESTAMP,
+    created_at  TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (valid_from IS NULL OR valid_to IS NULL OR valid_from < valid_to)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS accrual_rate_limits
+(
+    provider        VARCHAR(64) PRIMARY KEY,
+    backoff_until   TIMESTAMP,
+    window_start    TIMESTAMP,
+    window_requests INTEGER     NOT NULL DEFAULT 0
+);
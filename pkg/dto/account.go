@@ -0,0 +1,34 @@
+package dto
+
+type AccountDeletion struct {
+	Password string `json:"password"`
+	Code     string `json:"code,omitempty"`
+}
+
+type Profile struct {
+	ID               int64  `json:"id"`
+	Login            string `json:"login"`
+	RegisteredAt     string `json:"registered_at"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+}
+
+type BalanceChange struct {
+	Kind      string  `json:"kind"`
+	Amount    float64 `json:"amount"`
+	Reference string  `json:"reference"`
+	CreatedAt string  `json:"created_at"`
+}
+
+type AccountExport struct {
+	ExportedAt     string          `json:"exported_at"`
+	Profile        Profile         `json:"profile"`
+	Balance        Balance         `json:"balance"`
+	Orders         []Order         `json:"orders"`
+	Withdrawals    []Withdrawal    `json:"withdrawals"`
+	BalanceHistory []BalanceChange `json:"balance_history"`
+	Sessions       []Session       `json:"sessions"`
+}
+
+func (d AccountDeletion) IsValid() error {
+	return required("password", d.Password)
+}
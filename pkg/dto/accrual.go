@@ -1,7 +1,34 @@
 package dto
 
+import "errors"
+
 type AccrualResponse struct {
 	Order   string   `json:"order"`
 	Status  string   `json:"status"`
 	Accrual *float64 `json:"accrual,omitempty"`
 }
+
+// AccrualOrder registers an order with its goods in the accrual system.
+type AccrualOrder struct {
+	Order string        `json:"order"`
+	Goods []AccrualGood `json:"goods"`
+}
+
+type AccrualGood struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+func (r AccrualResponse) IsValid() error {
+	var statusErr, accrualErr error
+	switch r.Status {
+	case "REGISTERED", "INVALID", "PROCESSING", "PROCESSED":
+	default:
+		statusErr = FieldError{Field: "status", Message: "must be one of REGISTERED, INVALID, PROCESSING, PROCESSED"}
+	}
+	if r.Accrual != nil && *r.Accrual < 0 {
+		accrualErr = FieldError{Field: "accrual", Message: "must not be negative"}
+	}
+
+	return errors.Join(required("order", r.Order), statusErr, accrualErr)
+}
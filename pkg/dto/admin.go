@@ -0,0 +1,104 @@
+package dto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+const reasonMaxLength = 1000
+
+type AdminUser struct {
+	ID               int64    `json:"id"`
+	Login            string   `json:"login"`
+	Roles            []string `json:"roles"`
+	Status           string   `json:"status"`
+	TwoFactorEnabled bool     `json:"two_factor_enabled"`
+	Deleted          bool     `json:"deleted"`
+	RegisteredAt     string   `json:"registered_at"`
+	Balance          Balance  `json:"balance"`
+}
+
+type AdminOrder struct {
+	OrderDetails
+	UserID          int64  `json:"user_id"`
+	AccrualProvider string `json:"accrual_provider,omitempty"`
+}
+
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	OccurredAt string          `json:"occurred_at"`
+	ActorID    *int64          `json:"actor_id"`
+	IP         string          `json:"ip,omitempty"`
+	Type       string          `json:"event_type"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Outcome    string          `json:"outcome"`
+	Reason     string          `json:"reason,omitempty"`
+	Details    json.RawMessage `json:"details,omitempty"`
+}
+
+type AdminReason struct {
+	Reason string `json:"reason"`
+}
+
+type UserStatus struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type OrderOwner struct {
+	UserID int64  `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+type BalanceAdjustment struct {
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason"`
+}
+
+func (r AdminReason) IsValid() error {
+	return validateReason(r.Reason)
+}
+
+func (a BalanceAdjustment) IsValid() error {
+	var amountErr error
+	if a.Amount == 0 {
+		amountErr = FieldError{Field: "amount", Message: "must not be zero"}
+	}
+
+	return errors.Join(amountErr, validateReason(a.Reason))
+}
+
+func (o OrderOwner) IsValid() error {
+	var userErr error
+	if o.UserID <= 0 {
+		userErr = FieldError{Field: "user_id", Message: "must be positive"}
+	}
+
+	return errors.Join(userErr, validateReason(o.Reason))
+}
+
+func (s UserStatus) IsValid() error {
+	var statusErr error
+	switch s.Status {
+	case "active", "suspended", "closed":
+	default:
+		statusErr = FieldError{Field: "status", Message: "must be one of active, suspended, closed"}
+	}
+
+	return errors.Join(statusErr, validateReason(s.Reason))
+}
+
+func validateReason(reason string) error {
+	if err := required("reason", reason); err != nil {
+		return err
+	}
+
+	if utf8.RuneCountInString(reason) > reasonMaxLength {
+		return FieldError{Field: "reason", Message: fmt.Sprintf("must be at most %d characters long", reasonMaxLength)}
+	}
+
+	return nil
+}
@@ -3,24 +3,71 @@ package dto
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
+	"unicode/utf8"
 )
 
+// loginMaxLength matches the size of the users.login column.
+const loginMaxLength = 32
+
+var loginPattern = regexp.MustCompile(`^[A-Za-z0-9._@+-]+$`)
+
 type Auth struct {
 	Login    string
 	Password string
 }
 
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// FieldError describes a validation failure of a single request field.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// IsValid checks the credentials of a login. Logins registered before the
+// charset and length rules still have to be able to log in, so only
+// registration enforces them.
 func (a Auth) IsValid() error {
-	var logingErr, passwordErr error
+	return errors.Join(required("login", a.Login), required("password", a.Password))
+}
 
-	if strings.TrimSpace(a.Login) == "" {
-		logingErr = fmt.Errorf("login is required")
+func (a Auth) IsValidRegistration() error {
+	return errors.Join(validateLogin(a.Login), required("password", a.Password))
+}
+
+func (p PasswordChange) IsValid() error {
+	return errors.Join(required("current_password", p.CurrentPassword), required("new_password", p.NewPassword))
+}
+
+func validateLogin(login string) error {
+	if strings.TrimSpace(login) == "" {
+		return FieldError{Field: "login", Message: "is required"}
+	}
+
+	if utf8.RuneCountInString(login) > loginMaxLength {
+		return FieldError{Field: "login", Message: fmt.Sprintf("must be at most %d characters long", loginMaxLength)}
 	}
 
-	if strings.TrimSpace(a.Password) == "" {
-		passwordErr = fmt.Errorf("password is required")
+	if !loginPattern.MatchString(login) {
+		return FieldError{Field: "login", Message: "may only contain latin letters, digits and . _ @ + - characters"}
+	}
+
+	return nil
+}
+
+func required(field, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return FieldError{Field: field, Message: "is required"}
 	}
 
-	return errors.Join(logingErr, passwordErr)
+	return nil
 }
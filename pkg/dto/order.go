@@ -1,8 +1,108 @@
 package dto
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// storeIDMaxLength matches the size of the orders.store_id column.
+	storeIDMaxLength         = 64
+	maxGoods                 = 1000
+	goodDescriptionMaxLength = 1000
+)
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
 type Order struct {
-	Number     string   `json:"number"`
-	Status     string   `json:"status"`
-	Accrual    *float64 `json:"accrual,omitempty"`
-	UploadedAt string   `json:"uploaded_at"`
+	Number         string   `json:"number"`
+	Status         string   `json:"status"`
+	Accrual        *float64 `json:"accrual,omitempty"`
+	UploadedAt     string   `json:"uploaded_at"`
+	StoreID        string   `json:"store_id,omitempty"`
+	PurchaseAmount *float64 `json:"purchase_amount,omitempty"`
+	Currency       string   `json:"currency,omitempty"`
+	PurchasedAt    string   `json:"purchased_at,omitempty"`
+	// RegistrationStatus is set for orders uploaded with goods, which are
+	// registered with the accrual system by gophermart.
+	RegistrationStatus string `json:"registration_status,omitempty"`
+}
+
+// NewOrder is the JSON form of an order upload, which carries the metadata of
+// the purchase along with the number.
+type NewOrder struct {
+	Number         string      `json:"number"`
+	StoreID        string      `json:"store_id"`
+	PurchaseAmount *float64    `json:"purchase_amount"`
+	Currency       string      `json:"currency"`
+	PurchasedAt    *time.Time  `json:"purchased_at"`
+	Goods          []OrderGood `json:"goods"`
+}
+
+type OrderGood struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+type OrderStatusChange struct {
+	Status          string          `json:"status"`
+	Accrual         *float64        `json:"accrual,omitempty"`
+	AccrualResponse json.RawMessage `json:"accrual_response,omitempty"`
+	ChangedAt       string          `json:"changed_at"`
+}
+
+type OrderDetails struct {
+	Order
+	LastCheckedAt *string             `json:"last_checked_at,omitempty"`
+	CheckCount    int64               `json:"check_count"`
+	Goods         []OrderGood         `json:"goods,omitempty"`
+	History       []OrderStatusChange `json:"history"`
+}
+
+type OrderUpload struct {
+	Number string `json:"number"`
+	Result string `json:"result"`
+}
+
+func (o NewOrder) IsValid() error {
+	var storeErr, amountErr, currencyErr error
+	if utf8.RuneCountInString(o.StoreID) > storeIDMaxLength {
+		storeErr = FieldError{Field: "store_id", Message: fmt.Sprintf("must be at most %d characters long", storeIDMaxLength)}
+	}
+	if o.PurchaseAmount != nil && *o.PurchaseAmount < 0 {
+		amountErr = FieldError{Field: "purchase_amount", Message: "must not be negative"}
+	}
+	switch {
+	case o.Currency != "" && !currencyPattern.MatchString(o.Currency):
+		currencyErr = FieldError{Field: "currency", Message: "must be an ISO 4217 code"}
+	case o.Currency == "" && o.PurchaseAmount != nil:
+		currencyErr = FieldError{Field: "currency", Message: "is required with purchase_amount"}
+	}
+
+	return errors.Join(required("number", o.Number), storeErr, amountErr, currencyErr, validateGoods(o.Goods))
+}
+
+func validateGoods(goods []OrderGood) error {
+	if len(goods) > maxGoods {
+		return FieldError{Field: "goods", Message: fmt.Sprintf("must have at most %d items", maxGoods)}
+	}
+
+	for i, good := range goods {
+		field := fmt.Sprintf("goods[%d]", i)
+		if err := required(field+".description", good.Description); err != nil {
+			return err
+		}
+		if utf8.RuneCountInString(good.Description) > goodDescriptionMaxLength {
+			return FieldError{Field: field + ".description", Message: fmt.Sprintf("must be at most %d characters long", goodDescriptionMaxLength)}
+		}
+		if good.Price < 0 {
+			return FieldError{Field: field + ".price", Message: "must not be negative"}
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,59 @@
+package dto
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ruleNameMaxLength  = 255
+	ruleMatchMaxLength = 255
+)
+
+// RewardRule is a rule of the built-in rewards engine. An empty store_id or
+// match applies the rule to any store or good.
+type RewardRule struct {
+	ID         int64      `json:"id,omitempty"`
+	Name       string     `json:"name"`
+	StoreID    string     `json:"store_id,omitempty"`
+	Match      string     `json:"match"`
+	RewardType string     `json:"reward_type"`
+	Reward     float64    `json:"reward"`
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidTo    *time.Time `json:"valid_to,omitempty"`
+	UpdatedAt  string     `json:"updated_at,omitempty"`
+}
+
+func (r RewardRule) IsValid() error {
+	var nameErr, storeErr, matchErr, typeErr, rewardErr, windowErr error
+	if err := required("name", r.Name); err != nil {
+		nameErr = err
+	} else if utf8.RuneCountInString(r.Name) > ruleNameMaxLength {
+		nameErr = FieldError{Field: "name", Message: fmt.Sprintf("must be at most %d characters long", ruleNameMaxLength)}
+	}
+	if utf8.RuneCountInString(r.StoreID) > storeIDMaxLength {
+		storeErr = FieldError{Field: "store_id", Message: fmt.Sprintf("must be at most %d characters long", storeIDMaxLength)}
+	}
+	if utf8.RuneCountInString(r.Match) > ruleMatchMaxLength {
+		matchErr = FieldError{Field: "match", Message: fmt.Sprintf("must be at most %d characters long", ruleMatchMaxLength)}
+	}
+	switch r.RewardType {
+	case "percent":
+		if r.Reward > 100 {
+			rewardErr = FieldError{Field: "reward", Message: "must be at most 100 percent"}
+		}
+	case "fixed":
+	default:
+		typeErr = FieldError{Field: "reward_type", Message: "must be one of percent, fixed"}
+	}
+	if r.Reward <= 0 {
+		rewardErr = FieldError{Field: "reward", Message: "must be positive"}
+	}
+	if r.ValidFrom != nil && r.ValidTo != nil && !r.ValidFrom.Before(*r.ValidTo) {
+		windowErr = FieldError{Field: "valid_to", Message: "must be after valid_from"}
+	}
+
+	return errors.Join(nameErr, storeErr, matchErr, typeErr, rewardErr, windowErr)
+}
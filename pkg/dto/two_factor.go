@@ -0,0 +1,34 @@
+package dto
+
+import "errors"
+
+type TwoFactorChallenge struct {
+	Challenge string `json:"challenge"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+type TwoFactorLogin struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+type TwoFactorCode struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (l TwoFactorLogin) IsValid() error {
+	return errors.Join(required("challenge", l.Challenge), required("code", l.Code))
+}
+
+func (c TwoFactorCode) IsValid() error {
+	return required("code", c.Code)
+}
@@ -32,3 +32,7 @@ func Int64(key string, value int64) zap.Field {
 func Float64(key string, value float64) zap.Field {
 	return zap.Float64(key, value)
 }
+
+func Bool(key string, value bool) zap.Field {
+	return zap.Bool(key, value)
+}